@@ -0,0 +1,42 @@
+package cabbage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testBrokerOrdering sends messages 0..count-1 and checks that broker returns them in expected order
+func testBrokerOrdering(t *testing.T, broker CabbageBroker, queue string, count int, lifo bool) {
+	t.Helper()
+	for i := 0; i < count; i++ {
+		err := broker.SendCabbageMessage(queue, newCabbageMessage(taskName, []byte(fmt.Sprint(i))))
+		if err != nil {
+			t.Fatalf("cant send cb message, %v", err)
+		}
+	}
+	for i := 0; i < count; i++ {
+		expected := i
+		if lifo {
+			expected = count - 1 - i
+		}
+		var msg *CabbageMessage
+		var err error
+		// some brokers deliver messages asynchronously
+		for attempt := 0; attempt < 10; attempt++ {
+			if msg, err = broker.GetCabbageMessage(queue); err == nil {
+				break
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("cant get cb message, %v", err)
+		}
+		if string(msg.Body) != fmt.Sprint(expected) {
+			t.Errorf("invalid order, expected %d, got %s", expected, msg.Body)
+		}
+		if err := broker.AckCabbageMessage(queue, msg); err != nil {
+			t.Fatalf("cant ack cb message, %v", err)
+		}
+	}
+}
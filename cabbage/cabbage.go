@@ -1,6 +1,7 @@
 package cabbage
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -8,21 +9,43 @@ import (
 
 // CabbageClient provides API for sending cabbage tasks
 type CabbageClient struct {
-	broker         CabbageBroker
-	taskLock       sync.RWMutex
-	workers        map[string]*CabbageWorker
-	publisher      *Publisher
-	registredTasks map[string]*Task
+	broker           CabbageBroker
+	taskLock         sync.RWMutex
+	workers          map[string]*CabbageWorker
+	publisher        *Publisher
+	registredTasks   map[string]*Task
+	resultBackend    ResultBackend
+	codec            Codec
+	compression      *compression
+	security         *SecurityConfig
+	groupBackend     GroupBackend
+	revokeStore      RevokeStore
+	dedupStore       DedupStore
+	idempotencyStore IdempotencyStore
+	rateLimiter      RateLimiter
 }
 
 // CabbageBroker is interface for cabbage broker db
 type CabbageBroker interface {
+	// SendCabbageMessage sends message to queue, message with ETA must not be delivered to workers before ETA
 	SendCabbageMessage(queueName string, cbMessage *CabbageMessage) error
 	GetCabbageMessage(queueName string) (*CabbageMessage, error)
+	// AckCabbageMessage confirms that received message is proccessed and can be removed from broker
+	AckCabbageMessage(queueName string, cbMessage *CabbageMessage) error
+	// NackCabbageMessage returns failed received message to queue if requeue, otherwise message is dead lettered
+	NackCabbageMessage(queueName string, cbMessage *CabbageMessage, requeue bool) error
+	// RejectCabbageMessage returns received message, which cant be proccessed, to queue if requeue, otherwise message is dead lettered
+	RejectCabbageMessage(queueName string, cbMessage *CabbageMessage, requeue bool) error
 	EnableQueueForWorker(queueName string) error
 	Close()
 }
 
+// BlockingCabbageBroker is interface for brokers, which can wait for message instead of polling.
+// GetCabbageMessageWithContext blocks until message is received or context is done
+type BlockingCabbageBroker interface {
+	GetCabbageMessageWithContext(ctx context.Context, queueName string) (*CabbageMessage, error)
+}
+
 // NewCabbageClient create new CabbageClient
 func NewCabbageClient(broker CabbageBroker) *CabbageClient {
 	return &CabbageClient{
@@ -43,6 +66,12 @@ func (cc *CabbageClient) CreateWorker(queueName string, concurrency int) (*Cabba
 	if ok {
 		return nil, fmt.Errorf("worker for queue: %s exist", queueName)
 	}
+	worker.SetResultBackend(cc.resultBackend)
+	worker.SetSecurity(cc.security)
+	worker.SetGroupBackend(cc.groupBackend)
+	worker.SetRevokeStore(cc.revokeStore)
+	worker.SetIdempotencyStore(cc.idempotencyStore)
+	worker.SetRateLimiter(cc.rateLimiter)
 	cc.workers[queueName] = worker
 	return worker, nil
 }
@@ -50,10 +79,116 @@ func (cc *CabbageClient) CreateWorker(queueName string, concurrency int) (*Cabba
 // CreatePublisher create publisher for publish data to broker
 func (cc *CabbageClient) CreatePublisher() *Publisher {
 	publisher := newPublisher(cc.broker)
+	publisher.SetResultBackend(cc.resultBackend)
+	publisher.SetCodec(cc.codec)
+	publisher.SetSecurity(cc.security)
+	publisher.SetGroupBackend(cc.groupBackend)
+	publisher.SetDedupStore(cc.dedupStore)
+	if cc.compression != nil {
+		publisher.SetCompression(cc.compression.compressor, cc.compression.threshold)
+	}
 	cc.publisher = publisher
 	return publisher
 }
 
+// SetResultBackend set backend for storing task results for client workers, publisher and schedulers,
+// must be called before workers start
+func (cc *CabbageClient) SetResultBackend(backend ResultBackend) {
+	cc.resultBackend = backend
+	for _, worker := range cc.workers {
+		worker.SetResultBackend(backend)
+	}
+	if cc.publisher != nil {
+		cc.publisher.SetResultBackend(backend)
+	}
+}
+
+// SetGroupBackend set backend for storing groups state for client workers, publisher and schedulers,
+// must be called before workers start
+func (cc *CabbageClient) SetGroupBackend(backend GroupBackend) {
+	cc.groupBackend = backend
+	for _, worker := range cc.workers {
+		worker.SetGroupBackend(backend)
+	}
+	if cc.publisher != nil {
+		cc.publisher.SetGroupBackend(backend)
+	}
+}
+
+// SetRevokeStore set store of revoked tasks for client workers, must be called before workers start
+func (cc *CabbageClient) SetRevokeStore(store RevokeStore) {
+	cc.revokeStore = store
+	for _, worker := range cc.workers {
+		worker.SetRevokeStore(store)
+	}
+}
+
+// SetIdempotencyStore set store of processed task messages for client workers, must be called before workers start
+func (cc *CabbageClient) SetIdempotencyStore(store IdempotencyStore) {
+	cc.idempotencyStore = store
+	for _, worker := range cc.workers {
+		worker.SetIdempotencyStore(store)
+	}
+}
+
+// SetRateLimiter set limiter of tasks rate limits shared by client workers, must be called before workers start
+func (cc *CabbageClient) SetRateLimiter(limiter RateLimiter) {
+	cc.rateLimiter = limiter
+	for _, worker := range cc.workers {
+		worker.SetRateLimiter(limiter)
+	}
+}
+
+// Revoke revoke task by ID: workers skip revoked task message and, if terminate, cancel context of running task
+func (cc *CabbageClient) Revoke(taskID string, terminate bool) error {
+	if cc.revokeStore == nil {
+		return ErrNoRevokeStore
+	}
+	return cc.revokeStore.Revoke(taskID, terminate)
+}
+
+// SetDedupStore set store of unique tasks dedup keys for client publisher and schedulers
+func (cc *CabbageClient) SetDedupStore(store DedupStore) {
+	cc.dedupStore = store
+	if cc.publisher != nil {
+		cc.publisher.SetDedupStore(store)
+	}
+}
+
+// SetCodec set default codec for typed tasks payloads published by client publisher
+func (cc *CabbageClient) SetCodec(codec Codec) {
+	cc.codec = codec
+	if cc.publisher != nil {
+		cc.publisher.SetCodec(codec)
+	}
+}
+
+// SetCompression enable compression of message bodies published by client publisher,
+// which are not smaller than threshold bytes
+func (cc *CabbageClient) SetCompression(compressor Compressor, threshold int) {
+	cc.compression = &compression{compressor: compressor, threshold: threshold}
+	if cc.publisher != nil {
+		cc.publisher.SetCompression(compressor, threshold)
+	}
+}
+
+// SetSecurity set message signing and encryption settings for client workers, publisher and schedulers,
+// must be called before workers start
+func (cc *CabbageClient) SetSecurity(security *SecurityConfig) {
+	cc.security = security
+	for _, worker := range cc.workers {
+		worker.SetSecurity(security)
+	}
+	if cc.publisher != nil {
+		cc.publisher.SetSecurity(security)
+	}
+}
+
+// AsyncResult returns AsyncResult for task ID
+func (cc *CabbageClient) AsyncResult(ID string) *AsyncResult {
+	return newAsyncResult(ID, cc.resultBackend)
+}
+
 // Close connections
 func (cc *CabbageClient) Close() {
 	cc.broker.Close()
@@ -61,11 +196,16 @@ func (cc *CabbageClient) Close() {
 
 // RegisterTask register task for worker/publisher
 func (cc *CabbageClient) RegisterTask(task *Task) error {
+	if task.RateLimit != "" {
+		if _, err := ParseRateLimit(task.RateLimit); err != nil {
+			return err
+		}
+	}
 	cc.taskLock.Lock()
 	if task.TProccesser != nil {
 		worker, ok := cc.workers[task.QueueName]
 		if ok {
-			worker.RegisterTaskProcesser(task.Name, task.TProccesser)
+			worker.RegisterTask(task)
 		} else {
 			cc.taskLock.Unlock()
 			return errors.New("[!] try to register task proccesser, but not workers enabled")
@@ -81,5 +221,45 @@ func (cc *CabbageClient) RegisterTask(task *Task) error {
 // CreateScheduler create scheduler for schdule task
 func (cc *CabbageClient) CreateScheduler() *Scheduler {
 	scheduler := newScheduler(cc.broker)
+	scheduler.publisher.SetResultBackend(cc.resultBackend)
+	scheduler.publisher.SetSecurity(cc.security)
+	scheduler.publisher.SetGroupBackend(cc.groupBackend)
+	scheduler.publisher.SetDedupStore(cc.dedupStore)
 	return scheduler
 }
+
+// deadLetterBroker returns client broker as DeadLetterBroker
+func (cc *CabbageClient) deadLetterBroker() (DeadLetterBroker, error) {
+	dlBroker, ok := cc.broker.(DeadLetterBroker)
+	if !ok {
+		return nil, ErrDeadLettersNotSupported
+	}
+	return dlBroker, nil
+}
+
+// DeadLetters returns up to limit messages from queue dead letter queue, messages stay in dead letter queue
+func (cc *CabbageClient) DeadLetters(queueName string, limit int) ([]*CabbageMessage, error) {
+	dlBroker, err := cc.deadLetterBroker()
+	if err != nil {
+		return nil, err
+	}
+	return dlBroker.GetDeadLetters(queueName, limit)
+}
+
+// RequeueDeadLetters move all messages from dead letter queue back to queue, returns moved messages count
+func (cc *CabbageClient) RequeueDeadLetters(queueName string) (int, error) {
+	dlBroker, err := cc.deadLetterBroker()
+	if err != nil {
+		return 0, err
+	}
+	return dlBroker.RequeueDeadLetters(queueName)
+}
+
+// PurgeDeadLetters remove all messages from queue dead letter queue, returns removed messages count
+func (cc *CabbageClient) PurgeDeadLetters(queueName string) (int, error) {
+	dlBroker, err := cc.deadLetterBroker()
+	if err != nil {
+		return 0, err
+	}
+	return dlBroker.PurgeDeadLetters(queueName)
+}
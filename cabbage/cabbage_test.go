@@ -20,6 +20,18 @@ func (m *MockCabbageBroker) GetCabbageMessage(queueName string) (*CabbageMessage
 	return cbMessage, nil
 }
 
+func (m *MockCabbageBroker) AckCabbageMessage(queueName string, cbMessage *CabbageMessage) error {
+	return nil
+}
+
+func (m *MockCabbageBroker) NackCabbageMessage(queueName string, cbMessage *CabbageMessage, requeue bool) error {
+	return nil
+}
+
+func (m *MockCabbageBroker) RejectCabbageMessage(queueName string, cbMessage *CabbageMessage, requeue bool) error {
+	return nil
+}
+
 func (m *MockCabbageBroker) Close() {}
 
 type TestService struct {
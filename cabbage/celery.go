@@ -0,0 +1,306 @@
+package cabbage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// celery protocol v2 constants
+const (
+	celeryContentEncoding = "utf-8"
+	celeryBodyEncoding    = "base64"
+	// celeryETALayout python datetime.isoformat layout, which is parsed by all celery versions
+	celeryETALayout = "2006-01-02T15:04:05.000000-07:00"
+)
+
+// celeryHeaderKeys headers of celery protocol v2, other string headers are cabbage message headers
+var celeryHeaderKeys = map[string]bool{
+	"lang": true, "task": true, "id": true, "shadow": true, "eta": true, "expires": true, "group": true,
+	"group_index": true, "retries": true, "timelimit": true, "root_id": true, "parent_id": true,
+	"argsrepr": true, "kwargsrepr": true, "origin": true, "ignore_result": true, "stamped_headers": true, "stamps": true,
+}
+
+// ErrCeleryBody returned when message body cant be sent with celery protocol
+var ErrCeleryBody = errors.New("celery protocol supports only not compressed json bodies")
+
+// ErrCeleryCanvas returned when chain, group or chord is published to broker with celery protocol,
+// celery messages dont keep chain and group of cabbage message, so group state is never completed
+var ErrCeleryCanvas = errors.New("chains, groups and chords are not supported with celery protocol")
+
+// celeryProtocolBroker broker, which can send messages with celery protocol
+type celeryProtocolBroker interface {
+	celeryProtocol() bool
+}
+
+// usesCeleryProtocol checks that broker sends messages with celery protocol
+func usesCeleryProtocol(broker CabbageBroker) bool {
+	celeryBroker, ok := broker.(celeryProtocolBroker)
+	return ok && celeryBroker.celeryProtocol()
+}
+
+// celeryEmbed callbacks part of celery message body
+type celeryEmbed struct {
+	Callbacks interface{} `json:"callbacks"`
+	Errbacks  interface{} `json:"errbacks"`
+	Chain     interface{} `json:"chain"`
+	Chord     interface{} `json:"chord"`
+}
+
+// celeryRedisMessage kombu message envelope stored in redis list
+type celeryRedisMessage struct {
+	Body            string                 `json:"body"`
+	ContentEncoding string                 `json:"content-encoding"`
+	ContentType     string                 `json:"content-type"`
+	Headers         map[string]interface{} `json:"headers"`
+	Properties      celeryProperties       `json:"properties"`
+}
+
+// celeryProperties kombu message properties
+type celeryProperties struct {
+	CorrelationID string             `json:"correlation_id"`
+	ReplyTo       string             `json:"reply_to"`
+	DeliveryMode  int                `json:"delivery_mode"`
+	DeliveryInfo  celeryDeliveryInfo `json:"delivery_info"`
+	Priority      int                `json:"priority"`
+	BodyEncoding  string             `json:"body_encoding"`
+	DeliveryTag   string             `json:"delivery_tag"`
+}
+
+// celeryDeliveryInfo kombu message delivery info
+type celeryDeliveryInfo struct {
+	Exchange   string `json:"exchange"`
+	RoutingKey string `json:"routing_key"`
+}
+
+// celeryBody convert cabbage message body to celery body [args, kwargs, embed]:
+// json object is sent as kwargs, json array as args, other json value as single arg
+func celeryBody(cbMessage *CabbageMessage) ([]byte, error) {
+	if cbMessage.ContentEncoding != "" || (cbMessage.ContentType != "" && cbMessage.ContentType != ContentTypeJSON) {
+		return nil, ErrCeleryBody
+	}
+	body := bytes.TrimSpace(cbMessage.Body)
+	args, kwargs := json.RawMessage("[]"), json.RawMessage("{}")
+	switch {
+	case len(body) == 0:
+	case !json.Valid(body):
+		return nil, ErrCeleryBody
+	case body[0] == '{':
+		kwargs = body
+	case body[0] == '[':
+		args = body
+	default:
+		args = json.RawMessage("[" + string(body) + "]")
+	}
+	return json.Marshal([]interface{}{args, kwargs, celeryEmbed{}})
+}
+
+// cabbageBody convert celery body [args, kwargs, embed] to cabbage message body:
+// kwargs object if task has no args, args array if task has no kwargs,
+// otherwise object {"args": [...], "kwargs": {...}}
+func cabbageBody(data []byte) ([]byte, error) {
+	var parts []json.RawMessage
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return nil, fmt.Errorf("invalid celery body: %w", err)
+	}
+	if len(parts) < 2 {
+		return nil, errors.New("invalid celery body: args and kwargs are missing")
+	}
+	var args []json.RawMessage
+	var kwargs map[string]json.RawMessage
+	if err := json.Unmarshal(parts[0], &args); err != nil {
+		return nil, fmt.Errorf("invalid celery args: %w", err)
+	}
+	if err := json.Unmarshal(parts[1], &kwargs); err != nil {
+		return nil, fmt.Errorf("invalid celery kwargs: %w", err)
+	}
+	switch {
+	case len(args) == 0:
+		return parts[1], nil
+	case len(kwargs) == 0:
+		return parts[0], nil
+	default:
+		return json.Marshal(map[string]json.RawMessage{"args": parts[0], "kwargs": parts[1]})
+	}
+}
+
+// celeryOrigin name of publishing node
+func celeryOrigin() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%d@%s", os.Getpid(), hostname)
+}
+
+// celeryHeaders convert cabbage message to celery protocol v2 headers
+func celeryHeaders(cbMessage *CabbageMessage, body []byte) map[string]interface{} {
+	headers := make(map[string]interface{}, len(cbMessage.Headers)+16)
+	for key, value := range cbMessage.Headers {
+		if !celeryHeaderKeys[key] {
+			headers[key] = value
+		}
+	}
+	var parts []json.RawMessage
+	json.Unmarshal(body, &parts)
+	var eta, softTimeLimit interface{}
+	if cbMessage.ETA != nil {
+		eta = cbMessage.ETA.UTC().Format(celeryETALayout)
+	}
+	if cbMessage.Timeout > 0 {
+		softTimeLimit = cbMessage.Timeout.Seconds()
+	}
+	headers["lang"] = "go"
+	headers["task"] = cbMessage.TaskName
+	headers["id"] = cbMessage.ID
+	headers["shadow"] = nil
+	headers["eta"] = eta
+	headers["expires"] = nil
+	headers["group"] = nil
+	headers["group_index"] = nil
+	headers["retries"] = cbMessage.Retries
+	headers["timelimit"] = []interface{}{softTimeLimit, nil}
+	headers["root_id"] = cbMessage.ID
+	headers["parent_id"] = nil
+	headers["argsrepr"] = string(parts[0])
+	headers["kwargsrepr"] = string(parts[1])
+	headers["origin"] = celeryOrigin()
+	headers["ignore_result"] = false
+	return headers
+}
+
+// celeryHeadersToCabbageMessage convert celery protocol v2 headers to cabbage message
+func celeryHeadersToCabbageMessage(headers map[string]interface{}, body []byte) (*CabbageMessage, error) {
+	cbBody, err := cabbageBody(body)
+	if err != nil {
+		return nil, err
+	}
+	taskName, _ := headers["task"].(string)
+	ID, _ := headers["id"].(string)
+	if taskName == "" || ID == "" {
+		return nil, errors.New("invalid celery message: task and id headers are required")
+	}
+	cbMessage := &CabbageMessage{
+		ID:          ID,
+		MessageId:   uuid.NewV4().String(),
+		Body:        cbBody,
+		TaskName:    taskName,
+		Timestamp:   time.Now(),
+		Retries:     int(celeryNumber(headers["retries"])),
+		ContentType: ContentTypeJSON,
+	}
+	if eta, ok := headers["eta"].(string); ok && eta != "" {
+		parsed, err := parseCeleryETA(eta)
+		if err != nil {
+			return nil, err
+		}
+		cbMessage.ETA = &parsed
+	}
+	if timelimit, ok := headers["timelimit"].([]interface{}); ok && len(timelimit) > 0 {
+		cbMessage.Timeout = time.Duration(celeryNumber(timelimit[0]) * float64(time.Second))
+	}
+	for key, value := range headers {
+		// rabbitmq headers of messages returned from delay queue are skipped
+		if value, ok := value.(string); ok && !celeryHeaderKeys[key] && !isReservedHeader(key) {
+			if cbMessage.Headers == nil {
+				cbMessage.Headers = make(map[string]string)
+			}
+			cbMessage.Headers[key] = value
+		}
+	}
+	return cbMessage, nil
+}
+
+// celeryNumber convert json or amqp number to float64
+func celeryNumber(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	default:
+		return 0
+	}
+}
+
+// parseCeleryETA parse python isoformat datetime, naive datetime is UTC
+func parseCeleryETA(eta string) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339Nano, eta); err == nil {
+		return parsed, nil
+	}
+	parsed, err := time.Parse("2006-01-02T15:04:05.999999", eta)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid celery eta %s: %w", eta, err)
+	}
+	return parsed, nil
+}
+
+// encodeCeleryRedisMessage encode cabbage message to kombu envelope for redis queue
+func encodeCeleryRedisMessage(queueName string, cbMessage *CabbageMessage) (string, error) {
+	body, err := celeryBody(cbMessage)
+	if err != nil {
+		return "", err
+	}
+	envelope := celeryRedisMessage{
+		Body:            base64.StdEncoding.EncodeToString(body),
+		ContentEncoding: celeryContentEncoding,
+		ContentType:     ContentTypeJSON,
+		Headers:         celeryHeaders(cbMessage, body),
+		Properties: celeryProperties{
+			CorrelationID: cbMessage.ID,
+			DeliveryMode:  2,
+			DeliveryInfo:  celeryDeliveryInfo{RoutingKey: queueName},
+			BodyEncoding:  celeryBodyEncoding,
+			DeliveryTag:   cbMessage.MessageId,
+		},
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// decodeCeleryRedisMessage decode kombu envelope from redis queue to cabbage message
+func decodeCeleryRedisMessage(item string) (*CabbageMessage, error) {
+	var envelope celeryRedisMessage
+	if err := json.Unmarshal([]byte(item), &envelope); err != nil {
+		return nil, err
+	}
+	if envelope.ContentType != ContentTypeJSON {
+		return nil, fmt.Errorf("unsupported celery content type %s", envelope.ContentType)
+	}
+	body := []byte(envelope.Body)
+	if strings.EqualFold(envelope.Properties.BodyEncoding, celeryBodyEncoding) {
+		decoded, err := base64.StdEncoding.DecodeString(envelope.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = decoded
+	}
+	cbMessage, err := celeryHeadersToCabbageMessage(envelope.Headers, body)
+	if err != nil {
+		return nil, err
+	}
+	if envelope.Properties.DeliveryTag != "" {
+		cbMessage.MessageId = envelope.Properties.DeliveryTag
+	}
+	return cbMessage, nil
+}
@@ -0,0 +1,131 @@
+package cabbage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// pythonCeleryRedisMessage message published by celery 5 to redis with add.delay(2, 3)
+func pythonCeleryRedisMessage(eta string) string {
+	body := base64.StdEncoding.EncodeToString([]byte(`[[2, 3], {}, {"callbacks": null, "errbacks": null, "chain": null, "chord": null}]`))
+	return `{"body": "` + body + `", "content-encoding": "utf-8", "content-type": "application/json",
+"headers": {"lang": "py", "task": "tasks.add", "id": "9b7f3c1e-5d4a-4f2b-8c6d-1a2b3c4d5e6f", "shadow": null,
+"eta": ` + eta + `, "expires": null, "group": null, "group_index": null, "retries": 1, "timelimit": [30, null],
+"root_id": "9b7f3c1e-5d4a-4f2b-8c6d-1a2b3c4d5e6f", "parent_id": null, "argsrepr": "(2, 3)", "kwargsrepr": "{}",
+"origin": "gen42@worker", "ignore_result": false, "tenant": "acme"},
+"properties": {"correlation_id": "9b7f3c1e-5d4a-4f2b-8c6d-1a2b3c4d5e6f", "reply_to": "c1d2e3f4", "delivery_mode": 2,
+"delivery_info": {"exchange": "", "routing_key": "celery"}, "priority": 0, "body_encoding": "base64",
+"delivery_tag": "0f1e2d3c-4b5a-6978-8a9b-0c1d2e3f4a5b"}}`
+}
+
+func TestDecodeCeleryRedisMessage(t *testing.T) {
+	msg, err := decodeCeleryRedisMessage(pythonCeleryRedisMessage(`"2030-01-02T03:04:05.123456+00:00"`))
+	if err != nil {
+		t.Fatalf("cant decode celery message, %v", err)
+	}
+	if msg.ID != "9b7f3c1e-5d4a-4f2b-8c6d-1a2b3c4d5e6f" || msg.TaskName != "tasks.add" || msg.Retries != 1 {
+		t.Errorf("invalid celery message %+v", msg)
+	}
+	if string(msg.Body) != "[2, 3]" {
+		t.Errorf("celery args must be decoded to json array, got %s", msg.Body)
+	}
+	if msg.Timeout != 30*time.Second || msg.Headers["tenant"] != "acme" || len(msg.Headers) != 1 {
+		t.Errorf("invalid timeout %v or headers %v", msg.Timeout, msg.Headers)
+	}
+	eta := time.Date(2030, 1, 2, 3, 4, 5, 123456000, time.UTC)
+	if msg.ETA == nil || !msg.ETA.Equal(eta) {
+		t.Errorf("invalid eta %v", msg.ETA)
+	}
+	if msg, err := decodeCeleryRedisMessage(pythonCeleryRedisMessage(`"2030-01-02T03:04:05.123456"`)); err != nil || !msg.ETA.Equal(eta) {
+		t.Errorf("naive eta must be parsed as utc, got %v, %v", msg, err)
+	}
+}
+
+func TestCeleryBody(t *testing.T) {
+	cases := []struct{ body, args, kwargs, decoded string }{
+		{`{"orderId": 1}`, `[]`, `{"orderId":1}`, `{"orderId":1}`},
+		{`[1, "a"]`, `[1,"a"]`, `{}`, `[1,"a"]`},
+		{`42`, `[42]`, `{}`, `[42]`},
+		{``, `[]`, `{}`, `{}`},
+	}
+	for _, c := range cases {
+		data, err := celeryBody(&CabbageMessage{Body: []byte(c.body)})
+		if err != nil {
+			t.Fatalf("cant encode celery body %s, %v", c.body, err)
+		}
+		var parts []json.RawMessage
+		if err := json.Unmarshal(data, &parts); err != nil || len(parts) != 3 {
+			t.Fatalf("invalid celery body %s, %v", data, err)
+		}
+		if string(parts[0]) != c.args || string(parts[1]) != c.kwargs {
+			t.Errorf("body %s: invalid args %s or kwargs %s", c.body, parts[0], parts[1])
+		}
+		decoded, err := cabbageBody(data)
+		if err != nil || string(decoded) != c.decoded {
+			t.Errorf("body %s: invalid decoded body %s, %v", c.body, decoded, err)
+		}
+	}
+	decoded, err := cabbageBody([]byte(`[[1], {"a": 2}, {}]`))
+	if err != nil || string(decoded) != `{"args":[1],"kwargs":{"a":2}}` {
+		t.Errorf("invalid body with args and kwargs %s, %v", decoded, err)
+	}
+	if _, err := celeryBody(&CabbageMessage{Body: []byte("not json")}); err != ErrCeleryBody {
+		t.Errorf("not json body must not be sent with celery protocol, got %v", err)
+	}
+	if _, err := celeryBody(&CabbageMessage{Body: []byte("{}"), ContentEncoding: ContentEncodingGzip}); err != ErrCeleryBody {
+		t.Errorf("compressed body must not be sent with celery protocol, got %v", err)
+	}
+}
+
+func TestCeleryRedisMessageRoundTrip(t *testing.T) {
+	msg := newCabbageMessage(taskName, []byte(`{"orderId": 42}`))
+	msg.Retries = 2
+	msg.Timeout = 1500 * time.Millisecond
+	eta := time.Now().Add(time.Hour)
+	msg.ETA = &eta
+	msg.Headers = map[string]string{"tenant": "acme", "task": "spoofed"}
+	item, err := encodeCeleryRedisMessage(queueName, msg)
+	if err != nil {
+		t.Fatalf("cant encode celery message, %v", err)
+	}
+	var envelope celeryRedisMessage
+	if err := json.Unmarshal([]byte(item), &envelope); err != nil {
+		t.Fatalf("invalid celery envelope, %v", err)
+	}
+	if envelope.Headers["kwargsrepr"] != `{"orderId":42}` || envelope.Properties.DeliveryInfo.RoutingKey != queueName {
+		t.Errorf("invalid celery envelope %+v", envelope)
+	}
+	received, err := decodeCeleryRedisMessage(item)
+	if err != nil {
+		t.Fatalf("cant decode celery message, %v", err)
+	}
+	if received.ID != msg.ID || received.MessageId != msg.MessageId || received.TaskName != taskName || received.Retries != 2 {
+		t.Errorf("invalid received message %+v", received)
+	}
+	if string(received.Body) != `{"orderId":42}` || received.Timeout != msg.Timeout || received.Headers["tenant"] != "acme" {
+		t.Errorf("invalid received message %+v", received)
+	}
+	if received.ETA == nil || received.ETA.Sub(eta).Abs() > time.Microsecond {
+		t.Errorf("invalid received eta %v, expected %v", received.ETA, eta)
+	}
+}
+
+func TestPublishCanvasWithCeleryProtocol(t *testing.T) {
+	for name, broker := range map[string]CabbageBroker{"redis": &RedisBroker{celery: true}, "rabbitmq": &RabbitMQBroker{celery: true}} {
+		publisher := newTestPublisher(broker)
+		publisher.SetGroupBackend(NewMemoryGroupBackend())
+		group := NewGroup(GroupTask{TaskName: taskName, TPublisher: &testSchData{}})
+		if _, err := publisher.PublishGroup(group); !errors.Is(err, ErrCeleryCanvas) {
+			t.Errorf("%s: group must not be published with celery protocol, got %v", name, err)
+		}
+		if _, err := publisher.PublishChord(group, taskName); !errors.Is(err, ErrCeleryCanvas) {
+			t.Errorf("%s: chord must not be published with celery protocol, got %v", name, err)
+		}
+		if _, err := publisher.PublishChain(NewChain(taskName, taskName), &testSchData{}); !errors.Is(err, ErrCeleryCanvas) {
+			t.Errorf("%s: chain must not be published with celery protocol, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package cabbage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// Chain tasks, which are run sequentially: after task success worker publishes next task
+// with task result as body, failed task stops chain
+type Chain struct {
+	TaskNames []string
+}
+
+// NewChain construct Chain of registered tasks
+func NewChain(taskNames ...string) *Chain {
+	return &Chain{TaskNames: taskNames}
+}
+
+// ChainLink next task of chain, task ID is assigned on chain publish, so results of all chain tasks can be awaited
+type ChainLink struct {
+	ID        string `json:"id"`
+	TaskName  string `json:"taskName"`
+	QueueName string `json:"queueName"`
+}
+
+// ChainResult handle of published chain results
+type ChainResult struct {
+	Results []*AsyncResult // results of chain tasks in chain order
+}
+
+// Get waits for last chain task and returns its result, returns TaskFailedError of failed or revoked chain task
+// if chain failed
+func (r *ChainResult) Get(ctx context.Context) ([]byte, error) {
+	last := r.Results[len(r.Results)-1]
+	result, err := last.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if result.State != TaskStateSuccess {
+		if index, failed, err := r.FailedTask(); err == nil && index >= 0 {
+			return nil, &TaskFailedError{ID: failed.ID, Message: failed.Error}
+		}
+		return nil, &TaskFailedError{ID: last.ID, Message: result.Error}
+	}
+	return result.Result, nil
+}
+
+// Wait waits for last chain task final state not longer than timeout
+func (r *ChainResult) Wait(timeout time.Duration) (*TaskResult, error) {
+	return r.Results[len(r.Results)-1].Wait(timeout)
+}
+
+// FailedTask returns index and result of chain task, which failed or was revoked and stopped chain,
+// returns -1 if no task failed
+func (r *ChainResult) FailedTask() (int, *TaskResult, error) {
+	for index, asyncResult := range r.Results {
+		result, err := asyncResult.Result()
+		if err == ErrResultNotFound {
+			return -1, nil, nil
+		} else if err != nil {
+			return -1, nil, err
+		}
+		if result.State == TaskStateFailure || result.State == TaskStateRevoked {
+			return index, result, nil
+		}
+		if result.State != TaskStateSuccess {
+			return -1, nil, nil
+		}
+	}
+	return -1, nil, nil
+}
+
+// PublishChain publish first chain task with body, next tasks are published by workers. Options are applied
+// to first task, message headers are passed to all chain tasks
+func (p *Publisher) PublishChain(chain *Chain, tpublisher TaskPublisher, opts ...PublishOption) (*ChainResult, error) {
+	if chain == nil || len(chain.TaskNames) == 0 {
+		return nil, errors.New("empty chain")
+	}
+	if usesCeleryProtocol(p.broker) {
+		return nil, ErrCeleryCanvas
+	}
+	tasks := make([]*Task, 0, len(chain.TaskNames))
+	p.taskLock.RLock()
+	for _, taskName := range chain.TaskNames {
+		task, ok := p.registredTasks[taskName]
+		if !ok {
+			p.taskLock.RUnlock()
+			return nil, fmt.Errorf("missing chain task %s", taskName)
+		}
+		tasks = append(tasks, task)
+	}
+	p.taskLock.RUnlock()
+	body, err := tpublisher.ToPublish()
+	if err != nil {
+		return nil, err
+	}
+	cbMessage := newCabbageMessage(tasks[0].Name, body)
+	newPublishOptions(opts).apply(cbMessage)
+	chainResult := &ChainResult{Results: []*AsyncResult{newAsyncResult(cbMessage.ID, p.resultBackend)}}
+	for _, task := range tasks[1:] {
+		link := ChainLink{ID: uuid.NewV4().String(), TaskName: task.Name, QueueName: task.QueueName}
+		cbMessage.Chain = append(cbMessage.Chain, link)
+		chainResult.Results = append(chainResult.Results, newAsyncResult(link.ID, p.resultBackend))
+	}
+	// results of next tasks are pending until workers publish them
+	for _, link := range cbMessage.Chain {
+		p.setTaskResult(&TaskResult{ID: link.ID, TaskName: link.TaskName, State: TaskStatePending, PublishedAt: cbMessage.Timestamp})
+	}
+	if err := p.publish(tasks[0].QueueName, cbMessage); err != nil {
+		stopChain(cbMessage, err, p.setTaskResult)
+		return nil, err
+	}
+	return chainResult, nil
+}
+
+// newChainLinkMessage create message of next chain task with task result as body
+func newChainLinkMessage(cbMessage *CabbageMessage, result []byte) *CabbageMessage {
+	link := cbMessage.Chain[0]
+	next := newCabbageMessage(link.TaskName, result)
+	next.ID = link.ID
+	next.Headers = copyHeaders(cbMessage.Headers)
+	if len(cbMessage.Chain) > 1 {
+		next.Chain = append([]ChainLink(nil), cbMessage.Chain[1:]...)
+	}
+	return next
+}
+
+// stopChain store failure results of next chain tasks, which are not published because task failed
+func stopChain(cbMessage *CabbageMessage, err error, setTaskResult func(taskResult *TaskResult)) {
+	now := time.Now()
+	for _, link := range cbMessage.Chain {
+		setTaskResult(&TaskResult{
+			ID:          link.ID,
+			TaskName:    link.TaskName,
+			State:       TaskStateFailure,
+			Error:       fmt.Sprintf("chain stopped: task %s, id %s failed: %v", cbMessage.TaskName, cbMessage.ID, err),
+			PublishedAt: cbMessage.Timestamp,
+			FinishedAt:  &now,
+		})
+	}
+}
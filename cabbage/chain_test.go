@@ -0,0 +1,113 @@
+package cabbage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startTasksTestClient create client with memory broker, result and group backends, revoke store and started workers
+// for tasks queues
+func startTasksTestClient(t *testing.T, tasks ...*Task) *CabbageClient {
+	return startBrokerTasksTestClient(t, NewMemoryBroker(), tasks...)
+}
+
+// startBrokerTasksTestClient same as startTasksTestClient with given broker
+func startBrokerTasksTestClient(t *testing.T, broker CabbageBroker, tasks ...*Task) *CabbageClient {
+	client := NewCabbageClient(broker)
+	client.SetResultBackend(NewMemoryResultBackend())
+	client.SetGroupBackend(NewMemoryGroupBackend())
+	client.SetRevokeStore(NewMemoryRevokeStore(time.Minute))
+	client.CreatePublisher()
+	for _, task := range tasks {
+		if _, ok := client.workers[task.QueueName]; !ok {
+			if _, err := client.CreateWorker(task.QueueName, 1); err != nil {
+				t.Fatalf("cant create worker, %v", err)
+			}
+		}
+		task.WithPublish = true
+		if err := client.RegisterTask(task); err != nil {
+			t.Fatalf("cant register task, %v", err)
+		}
+	}
+	for _, worker := range client.workers {
+		worker.SetRevokeCheckPeriod(50 * time.Millisecond)
+		worker.StartWorker()
+	}
+	t.Cleanup(func() {
+		for _, worker := range client.workers {
+			worker.StopWorker()
+		}
+		client.Close()
+	})
+	return client
+}
+
+func TestChain(t *testing.T) {
+	client := startTasksTestClient(t,
+		&Task{Name: "fetch", QueueName: queueName, TProccesser: &resultTestService{}},
+		&Task{Name: "transform", QueueName: queueName + "_chain", TProccesser: &resultTestService{}},
+		&Task{Name: "store", QueueName: queueName, TProccesser: &resultTestService{}},
+	)
+	chainResult, err := client.publisher.PublishChain(NewChain("fetch", "transform", "store"), &testSchData{ID: "chain"}, Header("tenant", "acme"))
+	if err != nil {
+		t.Fatalf("cant publish chain, %v", err)
+	}
+	if len(chainResult.Results) != 3 {
+		t.Fatalf("invalid chain results count %d", len(chainResult.Results))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	result, err := chainResult.Get(ctx)
+	if err != nil {
+		t.Fatalf("cant get chain result, %v", err)
+	}
+	if string(result) != `result:result:result:{"id":"chain","site_id":""}` {
+		t.Errorf("every chain task must receive previous task result, got %s", result)
+	}
+	if index, _, err := chainResult.FailedTask(); err != nil || index != -1 {
+		t.Errorf("chain must not fail, got %d, %v", index, err)
+	}
+}
+
+func TestChainFailure(t *testing.T) {
+	failing := TaskProccesserFunc(func(ctx context.Context, body []byte, ID string) error {
+		return NonRetryable(errors.New("transform error"))
+	})
+	client := startTasksTestClient(t,
+		&Task{Name: "fetch", QueueName: queueName, TProccesser: &resultTestService{}},
+		&Task{Name: "transform", QueueName: queueName, TProccesser: failing},
+		&Task{Name: "store", QueueName: queueName, TProccesser: &resultTestService{}},
+	)
+	chainResult, err := client.publisher.PublishChain(NewChain("fetch", "transform", "store"), &testSchData{ID: "chain"})
+	if err != nil {
+		t.Fatalf("cant publish chain, %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err = chainResult.Get(ctx)
+	var failedErr *TaskFailedError
+	if !errors.As(err, &failedErr) || failedErr.ID != chainResult.Results[1].ID || failedErr.Message != "transform error" {
+		t.Fatalf("chain must fail with error of failed task, got %v", err)
+	}
+	index, failed, err := chainResult.FailedTask()
+	if err != nil || index != 1 || failed.TaskName != "transform" {
+		t.Errorf("second chain task must be failed, got %d, %+v, %v", index, failed, err)
+	}
+	last, err := chainResult.Results[2].Result()
+	if err != nil || last.State != TaskStateFailure || !strings.Contains(last.Error, "chain stopped: task transform") {
+		t.Errorf("last chain task must be stopped, got %+v, %v", last, err)
+	}
+}
+
+func TestPublishChainMissingTask(t *testing.T) {
+	publisher := newTestPublisher(NewMemoryBroker())
+	if _, err := publisher.PublishChain(NewChain(taskName, "missing"), &testSchData{}); err == nil {
+		t.Error("chain with not registered task must not be published")
+	}
+	if _, err := publisher.PublishChain(NewChain(), &testSchData{}); err == nil {
+		t.Error("empty chain must not be published")
+	}
+}
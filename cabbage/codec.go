@@ -0,0 +1,169 @@
+package cabbage
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// content types of built-in codecs
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeMsgpack  = "application/x-msgpack"
+	ContentTypeProtobuf = "application/x-protobuf"
+	ContentTypeGob      = "application/x-gob"
+)
+
+// Codec marshals and unmarshals task payloads, content type is stored in message,
+// so workers decode message with codec registered for its content type
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	ContentType() string
+}
+
+var (
+	codecsLock sync.RWMutex
+	codecs     = map[string]Codec{
+		ContentTypeJSON:     JSONCodec{},
+		ContentTypeMsgpack:  MsgpackCodec{},
+		ContentTypeProtobuf: ProtobufCodec{},
+		ContentTypeGob:      GobCodec{},
+	}
+)
+
+// RegisterCodec register codec for its content type, built-in codecs are registered by default
+func RegisterCodec(codec Codec) {
+	codecsLock.Lock()
+	codecs[codec.ContentType()] = codec
+	codecsLock.Unlock()
+}
+
+// CodecForContentType returns codec registered for content type
+func CodecForContentType(contentType string) (Codec, bool) {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+	codec, ok := codecs[contentType]
+	return codec, ok
+}
+
+// JSONCodec encodes task payloads with encoding/json, it is default codec
+type JSONCodec struct{}
+
+// Marshal encode v to json
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decode json data to v
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// ContentType returns application/json
+func (JSONCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+// MsgpackCodec encodes task payloads with MessagePack, struct fields are encoded
+// by json tags, if they have no msgpack tags
+type MsgpackCodec struct{}
+
+// Marshal encode v to msgpack
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decode msgpack data to v
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+// ContentType returns application/x-msgpack
+func (MsgpackCodec) ContentType() string {
+	return ContentTypeMsgpack
+}
+
+// ProtobufCodec encodes task payloads, which implement proto.Message
+type ProtobufCodec struct{}
+
+// Marshal encode proto message
+func (ProtobufCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf codec: %T is not proto.Message", v)
+	}
+	return proto.Marshal(m)
+}
+
+// Unmarshal decode proto message, v is proto.Message or pointer to proto.Message pointer,
+// which is allocated if nil
+func (ProtobufCodec) Unmarshal(data []byte, v interface{}) error {
+	if m, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, m)
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Ptr {
+		elem := rv.Elem()
+		if elem.IsNil() {
+			elem.Set(reflect.New(elem.Type().Elem()))
+		}
+		if m, ok := elem.Interface().(proto.Message); ok {
+			return proto.Unmarshal(data, m)
+		}
+	}
+	return fmt.Errorf("protobuf codec: %T is not proto.Message", v)
+}
+
+// ContentType returns application/x-protobuf
+func (ProtobufCodec) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+// GobCodec encodes task payloads with encoding/gob
+type GobCodec struct{}
+
+// Marshal encode v to gob
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decode gob data to v
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// ContentType returns application/x-gob
+func (GobCodec) ContentType() string {
+	return ContentTypeGob
+}
+
+// messageCodec returns codec for message content type, task codec is used for message without content type
+func messageCodec(cbMessage *CabbageMessage, taskCodec Codec) (Codec, error) {
+	if cbMessage == nil || cbMessage.ContentType == "" || cbMessage.ContentType == taskCodec.ContentType() {
+		return taskCodec, nil
+	}
+	codec, ok := CodecForContentType(cbMessage.ContentType)
+	if !ok {
+		return nil, fmt.Errorf("no codec for content type %s", cbMessage.ContentType)
+	}
+	return codec, nil
+}
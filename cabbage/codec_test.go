@@ -0,0 +1,83 @@
+package cabbage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestCodecsRoundTrip(t *testing.T) {
+	payload := typedTestPayload{OrderID: 42, Items: []string{"cabbage", "carrot"}}
+	for _, codec := range []Codec{JSONCodec{}, MsgpackCodec{}, GobCodec{}} {
+		data, err := codec.Marshal(payload)
+		if err != nil {
+			t.Fatalf("%s: cant marshal payload, %v", codec.ContentType(), err)
+		}
+		var decoded typedTestPayload
+		if err := codec.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("%s: cant unmarshal payload, %v", codec.ContentType(), err)
+		}
+		if decoded.OrderID != 42 || len(decoded.Items) != 2 || decoded.Items[1] != "carrot" {
+			t.Errorf("%s: invalid decoded payload %+v", codec.ContentType(), decoded)
+		}
+		if registered, ok := CodecForContentType(codec.ContentType()); !ok || registered.ContentType() != codec.ContentType() {
+			t.Errorf("%s: codec is not registered", codec.ContentType())
+		}
+	}
+}
+
+func TestProtobufCodec(t *testing.T) {
+	codec := ProtobufCodec{}
+	data, err := codec.Marshal(wrapperspb.String("cabbage"))
+	if err != nil {
+		t.Fatalf("cant marshal proto message, %v", err)
+	}
+	// typed task decodes payload to pointer of payload type
+	var decoded *wrapperspb.StringValue
+	if err := codec.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("cant unmarshal proto message, %v", err)
+	}
+	if decoded.GetValue() != "cabbage" {
+		t.Errorf("invalid decoded message %v", decoded)
+	}
+	if _, err := codec.Marshal(typedTestPayload{}); err == nil {
+		t.Error("protobuf codec must fail for not proto message")
+	}
+}
+
+func TestTypedTaskMessageContentType(t *testing.T) {
+	received := make(chan *wrapperspb.StringValue, 1)
+	task, _ := NewTypedTask(taskName, queueName, func(ctx context.Context, payload *wrapperspb.StringValue) error {
+		received <- payload
+		return nil
+	})
+	client, _ := startTestWorker(t, task)
+	client.SetCodec(ProtobufCodec{})
+	if _, err := PublishTyped(client.publisher, taskName, wrapperspb.String("cabbage")); err != nil {
+		t.Fatalf("cant publish typed task, %v", err)
+	}
+	select {
+	case payload := <-received:
+		if payload.GetValue() != "cabbage" {
+			t.Errorf("invalid payload %v", payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("task was not proccessed")
+	}
+}
+
+func TestTypedTaskUnknownContentType(t *testing.T) {
+	task, _ := NewTypedTask(taskName, queueName, func(ctx context.Context, payload typedTestPayload) error {
+		return nil
+	})
+	client, _ := startTestWorker(t, task)
+	if _, err := client.publisher.PublishTask(taskName, &testSchData{ID: "unknown"}, ContentType("application/x-unknown")); err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	deadLetter := waitDeadLetter(t, client.broker.(*MemoryBroker))
+	if deadLetter.ContentType != "application/x-unknown" {
+		t.Errorf("invalid content type %s", deadLetter.ContentType)
+	}
+}
@@ -0,0 +1,226 @@
+package cabbage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// content encodings of built-in compressors
+const (
+	ContentEncodingGzip   = "gzip"
+	ContentEncodingZstd   = "zstd"
+	ContentEncodingSnappy = "snappy"
+)
+
+// Compressor compresses message body, content encoding is stored in message,
+// so workers decompress body with compressor registered for its content encoding
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+	ContentEncoding() string
+}
+
+var (
+	compressorsLock sync.RWMutex
+	compressors     = map[string]Compressor{
+		ContentEncodingGzip:   GzipCompressor{},
+		ContentEncodingZstd:   ZstdCompressor{},
+		ContentEncodingSnappy: SnappyCompressor{},
+	}
+)
+
+// RegisterCompressor register compressor for its content encoding, built-in compressors are registered by default
+func RegisterCompressor(compressor Compressor) {
+	compressorsLock.Lock()
+	compressors[compressor.ContentEncoding()] = compressor
+	compressorsLock.Unlock()
+}
+
+// CompressorForContentEncoding returns compressor registered for content encoding
+func CompressorForContentEncoding(contentEncoding string) (Compressor, bool) {
+	compressorsLock.RLock()
+	defer compressorsLock.RUnlock()
+	compressor, ok := compressors[contentEncoding]
+	return compressor, ok
+}
+
+// DefaultMaxDecompressedSize default limit of decompressed message body size
+const DefaultMaxDecompressedSize = 64 << 20
+
+// ErrDecompressedTooLarge returned by built-in compressors when decompressed body exceeds limit,
+// so small compressed message cant make worker allocate unbounded memory
+var ErrDecompressedTooLarge = errors.New("decompressed body is too large")
+
+var maxDecompressedSize atomic.Int64
+
+func init() {
+	maxDecompressedSize.Store(DefaultMaxDecompressedSize)
+}
+
+// SetMaxDecompressedSize set limit of message body size decompressed by built-in compressors,
+// message with larger body is moved to dead letter queue
+func SetMaxDecompressedSize(size int64) {
+	maxDecompressedSize.Store(size)
+}
+
+// readDecompressed read decompressed data not larger than decompressed size limit
+func readDecompressed(r io.Reader) ([]byte, error) {
+	limit := maxDecompressedSize.Load()
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrDecompressedTooLarge
+	}
+	return data, nil
+}
+
+// GzipCompressor compresses message body with gzip
+type GzipCompressor struct{}
+
+// Compress data with gzip
+func (GzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress gzip data
+func (GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readDecompressed(r)
+}
+
+// ContentEncoding returns gzip
+func (GzipCompressor) ContentEncoding() string {
+	return ContentEncodingGzip
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdErr     error
+	// streaming zstd decoders, so decompressed size is limited while decoding
+	zstdDecoders = sync.Pool{New: func() interface{} {
+		decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return err
+		}
+		return decoder
+	}}
+)
+
+// initZstd create shared zstd encoder, it is safe for concurrent EncodeAll
+func initZstd() error {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+	})
+	return zstdErr
+}
+
+// ZstdCompressor compresses message body with zstd
+type ZstdCompressor struct{}
+
+// Compress data with zstd
+func (ZstdCompressor) Compress(data []byte) ([]byte, error) {
+	if err := initZstd(); err != nil {
+		return nil, err
+	}
+	return zstdEncoder.EncodeAll(data, nil), nil
+}
+
+// Decompress zstd data
+func (ZstdCompressor) Decompress(data []byte) ([]byte, error) {
+	pooled := zstdDecoders.Get()
+	decoder, ok := pooled.(*zstd.Decoder)
+	if !ok {
+		return nil, pooled.(error)
+	}
+	defer zstdDecoders.Put(decoder)
+	if err := decoder.Reset(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return readDecompressed(decoder)
+}
+
+// ContentEncoding returns zstd
+func (ZstdCompressor) ContentEncoding() string {
+	return ContentEncodingZstd
+}
+
+// SnappyCompressor compresses message body with snappy block format
+type SnappyCompressor struct{}
+
+// Compress data with snappy
+func (SnappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+// Decompress snappy data
+func (SnappyCompressor) Decompress(data []byte) ([]byte, error) {
+	// snappy block stores decoded length, so it is checked before allocation
+	size, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+	if int64(size) > maxDecompressedSize.Load() {
+		return nil, ErrDecompressedTooLarge
+	}
+	return snappy.Decode(nil, data)
+}
+
+// ContentEncoding returns snappy
+func (SnappyCompressor) ContentEncoding() string {
+	return ContentEncodingSnappy
+}
+
+// compression publisher compression settings
+type compression struct {
+	compressor Compressor
+	threshold  int // minimal body size for compression
+}
+
+// compress message body, if it is not smaller than threshold
+func (c *compression) compress(cbMessage *CabbageMessage) error {
+	if c == nil || c.compressor == nil || len(cbMessage.Body) < c.threshold || cbMessage.ContentEncoding != "" {
+		return nil
+	}
+	compressed, err := c.compressor.Compress(cbMessage.Body)
+	if err != nil {
+		return err
+	}
+	cbMessage.Body = compressed
+	cbMessage.ContentEncoding = c.compressor.ContentEncoding()
+	return nil
+}
+
+// decompressBody returns decompressed message body
+func decompressBody(cbMessage *CabbageMessage) ([]byte, error) {
+	if cbMessage.ContentEncoding == "" {
+		return cbMessage.Body, nil
+	}
+	compressor, ok := CompressorForContentEncoding(cbMessage.ContentEncoding)
+	if !ok {
+		return nil, fmt.Errorf("no compressor for content encoding %s", cbMessage.ContentEncoding)
+	}
+	return compressor.Decompress(cbMessage.Body)
+}
@@ -0,0 +1,121 @@
+package cabbage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCompressorsRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"id":"cabbage","site_id":"carrot"}`), 100)
+	for _, compressor := range []Compressor{GzipCompressor{}, ZstdCompressor{}, SnappyCompressor{}} {
+		compressed, err := compressor.Compress(data)
+		if err != nil {
+			t.Fatalf("%s: cant compress data, %v", compressor.ContentEncoding(), err)
+		}
+		if len(compressed) >= len(data) {
+			t.Errorf("%s: data is not compressed, %d >= %d", compressor.ContentEncoding(), len(compressed), len(data))
+		}
+		decompressed, err := compressor.Decompress(compressed)
+		if err != nil {
+			t.Fatalf("%s: cant decompress data, %v", compressor.ContentEncoding(), err)
+		}
+		if !bytes.Equal(decompressed, data) {
+			t.Errorf("%s: invalid decompressed data", compressor.ContentEncoding())
+		}
+	}
+}
+
+func TestPublisherCompressionThreshold(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	publisher := newTestPublisher(broker)
+	publisher.SetCompression(GzipCompressor{}, 100)
+	publisher.PublishTask(taskName, &testSchData{ID: "small"})
+	publisher.PublishTask(taskName, &testSchData{ID: string(bytes.Repeat([]byte("large"), 100))})
+	small, _ := broker.GetCabbageMessage(queueName)
+	if small.ContentEncoding != "" || string(small.Body) != `{"id":"small","site_id":""}` {
+		t.Errorf("message smaller than threshold must not be compressed, %s", small.ContentEncoding)
+	}
+	large, _ := broker.GetCabbageMessage(queueName)
+	if large.ContentEncoding != ContentEncodingGzip {
+		t.Errorf("message larger than threshold must be compressed, %s", large.ContentEncoding)
+	}
+}
+
+func TestWorkerDecompression(t *testing.T) {
+	for _, compressor := range []Compressor{GzipCompressor{}, ZstdCompressor{}, SnappyCompressor{}} {
+		t.Run(compressor.ContentEncoding(), func(t *testing.T) {
+			received := make(chan typedTestPayload, 1)
+			task, _ := NewTypedTask(taskName, queueName, func(ctx context.Context, payload typedTestPayload) error {
+				received <- payload
+				return nil
+			})
+			client, _ := startTestWorker(t, task)
+			client.SetCompression(compressor, 0)
+			if _, err := PublishTyped(client.publisher, taskName, typedTestPayload{OrderID: 42}); err != nil {
+				t.Fatalf("cant publish task, %v", err)
+			}
+			select {
+			case payload := <-received:
+				if payload.OrderID != 42 {
+					t.Errorf("invalid payload %+v", payload)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("task was not proccessed")
+			}
+		})
+	}
+}
+
+func TestWorkerMalformedMessage(t *testing.T) {
+	service := &countingTestService{count: make(chan struct{}, 1)}
+	client, _ := startTestWorker(t, &Task{Name: taskName, QueueName: queueName, TProccesser: service})
+	msg := newCabbageMessage(taskName, []byte("not gzip"))
+	msg.ContentEncoding = ContentEncodingGzip
+	client.broker.SendCabbageMessage(queueName, msg)
+	deadLetter := waitDeadLetter(t, client.broker.(*MemoryBroker))
+	if deadLetter.DeadLetter.Reason != DeadLetterReasonMalformed || string(deadLetter.Body) != "not gzip" {
+		t.Errorf("invalid dead letter %+v", deadLetter)
+	}
+	if len(service.count) != 0 {
+		t.Error("malformed message must not be proccessed")
+	}
+}
+
+func TestDecompressedSizeLimit(t *testing.T) {
+	SetMaxDecompressedSize(1 << 10)
+	t.Cleanup(func() { SetMaxDecompressedSize(DefaultMaxDecompressedSize) })
+	data := make([]byte, 1<<20)
+	for _, compressor := range []Compressor{GzipCompressor{}, ZstdCompressor{}, SnappyCompressor{}} {
+		compressed, err := compressor.Compress(data)
+		if err != nil {
+			t.Fatalf("%s: cant compress data, %v", compressor.ContentEncoding(), err)
+		}
+		if _, err := compressor.Decompress(compressed); err != ErrDecompressedTooLarge {
+			t.Errorf("%s: expected ErrDecompressedTooLarge, got %v", compressor.ContentEncoding(), err)
+		}
+		if _, err := compressor.Decompress(data[:0]); err == ErrDecompressedTooLarge {
+			t.Errorf("%s: small data must not exceed limit", compressor.ContentEncoding())
+		}
+	}
+}
+
+func TestWorkerDecompressionBomb(t *testing.T) {
+	SetMaxDecompressedSize(1 << 10)
+	t.Cleanup(func() { SetMaxDecompressedSize(DefaultMaxDecompressedSize) })
+	service := &countingTestService{count: make(chan struct{}, 1)}
+	client, _ := startTestWorker(t, &Task{Name: taskName, QueueName: queueName, TProccesser: service})
+	compressed, _ := GzipCompressor{}.Compress(make([]byte, 1<<20))
+	msg := newCabbageMessage(taskName, compressed)
+	msg.ContentEncoding = ContentEncodingGzip
+	client.broker.SendCabbageMessage(queueName, msg)
+	deadLetter := waitDeadLetter(t, client.broker.(*MemoryBroker))
+	if deadLetter.DeadLetter.Reason != DeadLetterReasonMalformed || deadLetter.DeadLetter.Error != ErrDecompressedTooLarge.Error() {
+		t.Errorf("invalid dead letter %+v", deadLetter.DeadLetter)
+	}
+	if len(service.count) != 0 {
+		t.Error("message with too large body must not be proccessed")
+	}
+}
@@ -0,0 +1,92 @@
+package cabbage
+
+import (
+	"context"
+	"time"
+)
+
+// contextKey type for cabbage context values
+type contextKey int
+
+const (
+	taskInfoContextKey contextKey = iota
+	messageContextKey
+)
+
+// TaskInfo metadata of proccessing task message
+type TaskInfo struct {
+	ID          string
+	MessageId   string
+	TaskName    string
+	Queue       string
+	PublishedAt time.Time
+	ETA         *time.Time // nil for not delayed message
+	StartedAt   time.Time  // time when worker started task proccessing
+	Attempt     int        // current attempt number, starting from 1
+	MaxAttempts int        // task retry policy max attempts, 1 if task has no retry policy
+	Headers     map[string]string
+}
+
+// newTaskInfo create TaskInfo for message received by worker from queue
+func newTaskInfo(cbMessage *CabbageMessage, queueName string, task *Task) *TaskInfo {
+	maxAttempts := 1
+	if task != nil && task.RetryPolicy != nil && task.RetryPolicy.MaxAttempts > 1 {
+		maxAttempts = task.RetryPolicy.MaxAttempts
+	}
+	return &TaskInfo{
+		ID:          cbMessage.ID,
+		MessageId:   cbMessage.MessageId,
+		TaskName:    cbMessage.TaskName,
+		Queue:       queueName,
+		PublishedAt: cbMessage.Timestamp,
+		ETA:         cbMessage.ETA,
+		StartedAt:   time.Now(),
+		Attempt:     cbMessage.Retries + 1,
+		MaxAttempts: maxAttempts,
+		Headers:     copyHeaders(cbMessage.Headers),
+	}
+}
+
+// QueueLatency returns time which message spent in queue before proccessing,
+// for delayed message latency is counted from ETA
+func (i *TaskInfo) QueueLatency() time.Duration {
+	since := i.PublishedAt
+	if i.ETA != nil && i.ETA.After(since) {
+		since = *i.ETA
+	}
+	return i.StartedAt.Sub(since)
+}
+
+// IsLastAttempt checks that task will not be retried after failure
+func (i *TaskInfo) IsLastAttempt() bool {
+	return i.Attempt >= i.MaxAttempts
+}
+
+// TaskInfoFromContext returns metadata of proccessing task, nil outside of worker
+func TaskInfoFromContext(ctx context.Context) *TaskInfo {
+	info, _ := ctx.Value(taskInfoContextKey).(*TaskInfo)
+	return info
+}
+
+// TaskAttemptFromContext returns current attempt number of proccessing task, starting from 1
+func TaskAttemptFromContext(ctx context.Context) int {
+	info := TaskInfoFromContext(ctx)
+	if info == nil {
+		return 1
+	}
+	return info.Attempt
+}
+
+// CabbageMessageFromContext returns proccessing cabbage message, nil outside of worker
+func CabbageMessageFromContext(ctx context.Context) *CabbageMessage {
+	cbMessage, _ := ctx.Value(messageContextKey).(*CabbageMessage)
+	return cbMessage
+}
+
+// HeadersFromContext returns headers of proccessing cabbage message, nil outside of worker
+func HeadersFromContext(ctx context.Context) map[string]string {
+	if info := TaskInfoFromContext(ctx); info != nil {
+		return copyHeaders(info.Headers)
+	}
+	return nil
+}
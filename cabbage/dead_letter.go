@@ -0,0 +1,80 @@
+package cabbage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// dead letter reasons
+const (
+	DeadLetterReasonUnroutable = "unroutable" // no task proccesser for message
+	DeadLetterReasonFailed     = "failed"     // task failed and exhausted retries
+	DeadLetterReasonRejected   = "rejected"   // message rejected or nacked without requeue
+	DeadLetterReasonTimeout    = "timeout"    // task exceeded timeout and exhausted retries
+	DeadLetterReasonPanic      = "panic"      // task panicked and exhausted retries
+	DeadLetterReasonMalformed  = "malformed"  // message cant be decoded or its body cant be decrypted or decompressed
+	DeadLetterReasonUnverified = "unverified" // message is not signed or has invalid signature
+)
+
+// ErrDeadLettersNotSupported returned when broker does not implement DeadLetterBroker
+var ErrDeadLettersNotSupported = errors.New("broker does not support dead letters")
+
+// DeadLetter describes why message was moved to dead letter queue
+type DeadLetter struct {
+	Reason    string    `json:"reason"`
+	Error     string    `json:"error"`
+	Attempts  int       `json:"attempts"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// DeadLetterBroker is interface for brokers with dead letter queues
+type DeadLetterBroker interface {
+	SendDeadLetter(queueName string, cbMessage *CabbageMessage) error
+	GetDeadLetters(queueName string, limit int) ([]*CabbageMessage, error)
+	RequeueDeadLetters(queueName string) (int, error)
+	PurgeDeadLetters(queueName string) (int, error)
+}
+
+// deadLetterQueueName generate dead letter queue name for queue
+func deadLetterQueueName(queueName string) string {
+	return fmt.Sprintf("%s_cabbage_dead_letter", queueName)
+}
+
+// newDeadLetterMessage create copy of cabbage message with dead letter info
+func newDeadLetterMessage(cbMessage *CabbageMessage, reason string, err error) *CabbageMessage {
+	dlMessage := *cbMessage
+	dlMessage.receipt = nil
+	dlMessage.DeadLetter = &DeadLetter{
+		Reason:    reason,
+		Attempts:  cbMessage.Retries + 1,
+		Timestamp: time.Now(),
+	}
+	if err != nil {
+		dlMessage.DeadLetter.Error = err.Error()
+	}
+	return &dlMessage
+}
+
+// deadLetterReason returns dead letter reason for task error
+func deadLetterReason(err error) string {
+	var timeoutErr *TaskTimeoutError
+	var panicErr *TaskPanicError
+	switch {
+	case errors.As(err, &timeoutErr):
+		return DeadLetterReasonTimeout
+	case errors.As(err, &panicErr):
+		return DeadLetterReasonPanic
+	default:
+		return DeadLetterReasonFailed
+	}
+}
+
+// newRequeuedMessage create copy of dead letter message for sending back to queue
+func newRequeuedMessage(cbMessage *CabbageMessage) *CabbageMessage {
+	requeued := *cbMessage
+	requeued.DeadLetter = nil
+	requeued.Retries = 0
+	requeued.receipt = nil
+	return &requeued
+}
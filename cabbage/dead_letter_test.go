@@ -0,0 +1,68 @@
+package cabbage
+
+import (
+	"testing"
+)
+
+func TestWorkerDeadLetters(t *testing.T) {
+	service := &flakyTestService{failures: 10, attempts: make(chan int, 10)}
+	task := &Task{Name: taskName, QueueName: queueName, TProccesser: service, RetryPolicy: NewRetryPolicy(2, nil)}
+	client, _ := startTestWorker(t, task)
+	if _, err := client.publisher.PublishTask(taskName, &testSchData{ID: "dead"}); err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	unroutable := newCabbageMessage("unknownTask", body)
+	if err := client.broker.SendCabbageMessage(queueName, unroutable); err != nil {
+		t.Fatalf("cant send message, %v", err)
+	}
+	var deadLetters []*CabbageMessage
+	waitFor(t, func() bool {
+		deadLetters, _ = client.DeadLetters(queueName, 0)
+		return len(deadLetters) == 2
+	})
+	reasons := map[string]*DeadLetter{}
+	for _, msg := range deadLetters {
+		reasons[msg.DeadLetter.Reason] = msg.DeadLetter
+	}
+	if dl := reasons[DeadLetterReasonFailed]; dl == nil || dl.Attempts != 2 || dl.Error != "flaky error" {
+		t.Errorf("invalid failed dead letter %+v", dl)
+	}
+	if dl := reasons[DeadLetterReasonUnroutable]; dl == nil || dl.Attempts != 1 || dl.Error == "" {
+		t.Errorf("invalid unroutable dead letter %+v", dl)
+	}
+	if limited, _ := client.DeadLetters(queueName, 1); len(limited) != 1 {
+		t.Errorf("dead letters limit must be 1, got %d", len(limited))
+	}
+}
+
+func TestDeadLettersRequeueAndPurge(t *testing.T) {
+	broker := NewMemoryBroker()
+	client := NewCabbageClient(broker)
+	defer client.Close()
+	for i := 0; i < 3; i++ {
+		cbMessage := newCabbageMessage(taskName, body)
+		cbMessage.Retries = 2
+		broker.SendDeadLetter(queueName, newDeadLetterMessage(cbMessage, DeadLetterReasonFailed, nil))
+	}
+	count, err := client.RequeueDeadLetters(queueName)
+	if err != nil || count != 3 {
+		t.Fatalf("must requeue 3 dead letters, got %d, %v", count, err)
+	}
+	msg, _ := broker.GetCabbageMessage(queueName)
+	if msg.DeadLetter != nil || msg.Retries != 0 {
+		t.Errorf("requeued message must be reset, got %+v", msg)
+	}
+	broker.SendDeadLetter(queueName, msg)
+	count, err = client.PurgeDeadLetters(queueName)
+	if err != nil || count != 1 {
+		t.Fatalf("must purge 1 dead letter, got %d, %v", count, err)
+	}
+	if deadLetters, _ := client.DeadLetters(queueName, 0); len(deadLetters) != 0 {
+		t.Errorf("dead letters must be empty after purge, got %d", len(deadLetters))
+	}
+
+	mockClient := NewCabbageClient(testbroker)
+	if _, err := mockClient.DeadLetters(queueName, 0); err != ErrDeadLettersNotSupported {
+		t.Errorf("expected ErrDeadLettersNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,410 @@
+package cabbage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+var (
+	// ErrGroupNotFound returned by GroupBackend when group is missing
+	ErrGroupNotFound = errors.New("group not found")
+	// ErrNoGroupBackend returned when group is published without group backend
+	ErrNoGroupBackend = errors.New("group backend is not set")
+)
+
+// Group tasks, which are run in parallel, group is done when all tasks are finished
+type Group struct {
+	Tasks []GroupTask
+}
+
+// GroupTask task of group with its body
+type GroupTask struct {
+	TaskName   string
+	TPublisher TaskPublisher
+}
+
+// NewGroup construct Group of registered tasks
+func NewGroup(tasks ...GroupTask) *Group {
+	return &Group{Tasks: tasks}
+}
+
+// GroupMember group of message task
+type GroupMember struct {
+	GroupID string `json:"groupId"`
+	Index   int    `json:"index"` // index of task in group
+}
+
+// GroupTaskResult final result of group task
+type GroupTaskResult struct {
+	Success bool   `json:"success"`
+	Result  []byte `json:"result,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// GroupProgress counts of finished group tasks
+type GroupProgress struct {
+	Size      int `json:"size"`
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+// Done checks that all group tasks are finished
+func (p GroupProgress) Done() bool {
+	return p.Succeeded+p.Failed >= p.Size
+}
+
+// GroupState group tasks and results stored in GroupBackend
+type GroupState struct {
+	ID       string
+	TaskIDs  []string
+	Callback *ChainLink // chord callback task, nil for group
+	GroupProgress
+	Results []*GroupTaskResult // results of group tasks in group order, nil for not finished task
+}
+
+// GroupBackend is interface for groups state storage, state must be shared by workers and publishers
+type GroupBackend interface {
+	CreateGroup(group *GroupState) error
+	// CompleteGroupTask atomically stores final result of group task and returns group progress after it.
+	// Result of task is stored only once, so redelivered task does not change progress and false is returned.
+	// Returns ErrGroupNotFound if group is missing
+	CompleteGroupTask(groupID string, index int, result *GroupTaskResult) (GroupProgress, bool, error)
+	// GetGroup returns ErrGroupNotFound if group is missing
+	GetGroup(groupID string) (*GroupState, error)
+}
+
+// GroupResult handle of published group or chord
+type GroupResult struct {
+	ID       string
+	Results  []*AsyncResult // results of group tasks in group order
+	Callback *AsyncResult   // result of chord callback task, nil for group
+	backend  GroupBackend
+}
+
+// Progress returns current group progress
+func (r *GroupResult) Progress() (GroupProgress, error) {
+	group, err := r.backend.GetGroup(r.ID)
+	if err != nil {
+		return GroupProgress{}, err
+	}
+	return group.GroupProgress, nil
+}
+
+// Get waits for all group tasks and returns their results in group order,
+// returns TaskFailedError of first failed task if any group task failed
+func (r *GroupResult) Get(ctx context.Context) ([][]byte, error) {
+	ticker := time.NewTicker(resultPollPeriod)
+	defer ticker.Stop()
+	for {
+		group, err := r.backend.GetGroup(r.ID)
+		if err != nil {
+			return nil, err
+		}
+		if group.Done() {
+			return groupResults(group)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// groupResults returns results of finished group, returns TaskFailedError of first failed task
+func groupResults(group *GroupState) ([][]byte, error) {
+	results := make([][]byte, len(group.Results))
+	for index, result := range group.Results {
+		if result != nil && !result.Success {
+			return nil, &TaskFailedError{ID: group.TaskIDs[index], Message: result.Error}
+		}
+		if result != nil {
+			results[index] = result.Result
+		}
+	}
+	return results, nil
+}
+
+// chordCallbackBody encode group results to json array for chord callback task,
+// json results are embedded as is, other results are encoded as json strings
+func chordCallbackBody(results [][]byte) ([]byte, error) {
+	items := make([]interface{}, len(results))
+	for index, result := range results {
+		switch {
+		case result == nil:
+			items[index] = nil
+		case json.Valid(result):
+			items[index] = json.RawMessage(result)
+		default:
+			items[index] = string(result)
+		}
+	}
+	return json.Marshal(items)
+}
+
+// PublishGroup publish all group tasks, options are applied to every group task
+func (p *Publisher) PublishGroup(group *Group, opts ...PublishOption) (*GroupResult, error) {
+	return p.publishGroup(group, "", opts)
+}
+
+// PublishChord publish group tasks and store callback task, which is published by worker after all group tasks
+// succeeded with json array of group tasks results as body. Callback is not published if any group task failed
+func (p *Publisher) PublishChord(group *Group, callbackTaskName string, opts ...PublishOption) (*GroupResult, error) {
+	if callbackTaskName == "" {
+		return nil, errors.New("chord callback task is not set")
+	}
+	return p.publishGroup(group, callbackTaskName, opts)
+}
+
+// publishGroup create group state and publish group tasks, group tasks, which are not published,
+// are completed as failed, so group is finished
+func (p *Publisher) publishGroup(group *Group, callbackTaskName string, opts []PublishOption) (*GroupResult, error) {
+	if group == nil || len(group.Tasks) == 0 {
+		return nil, errors.New("empty group")
+	}
+	if usesCeleryProtocol(p.broker) {
+		return nil, ErrCeleryCanvas
+	}
+	p.taskLock.RLock()
+	backend := p.groupBackend
+	queues := make([]string, 0, len(group.Tasks))
+	for _, groupTask := range group.Tasks {
+		task, ok := p.registredTasks[groupTask.TaskName]
+		if !ok {
+			p.taskLock.RUnlock()
+			return nil, fmt.Errorf("missing group task %s", groupTask.TaskName)
+		}
+		queues = append(queues, task.QueueName)
+	}
+	var callback *ChainLink
+	if callbackTaskName != "" {
+		task, ok := p.registredTasks[callbackTaskName]
+		if !ok {
+			p.taskLock.RUnlock()
+			return nil, fmt.Errorf("missing chord callback task %s", callbackTaskName)
+		}
+		callback = &ChainLink{ID: uuid.NewV4().String(), TaskName: task.Name, QueueName: task.QueueName}
+	}
+	p.taskLock.RUnlock()
+	if backend == nil {
+		return nil, ErrNoGroupBackend
+	}
+	messages := make([]*CabbageMessage, 0, len(group.Tasks))
+	for _, groupTask := range group.Tasks {
+		body, err := groupTask.TPublisher.ToPublish()
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, newCabbageMessage(groupTask.TaskName, body))
+	}
+	state := &GroupState{ID: uuid.NewV4().String(), Callback: callback, GroupProgress: GroupProgress{Size: len(messages)}}
+	groupResult := &GroupResult{ID: state.ID, backend: backend}
+	for index, cbMessage := range messages {
+		newPublishOptions(opts).apply(cbMessage)
+		cbMessage.Group = &GroupMember{GroupID: state.ID, Index: index}
+		state.TaskIDs = append(state.TaskIDs, cbMessage.ID)
+		groupResult.Results = append(groupResult.Results, newAsyncResult(cbMessage.ID, p.resultBackend))
+	}
+	if err := backend.CreateGroup(state); err != nil {
+		return nil, err
+	}
+	if callback != nil {
+		groupResult.Callback = newAsyncResult(callback.ID, p.resultBackend)
+		p.setTaskResult(&TaskResult{ID: callback.ID, TaskName: callback.TaskName, State: TaskStatePending, PublishedAt: time.Now()})
+	}
+	for index, cbMessage := range messages {
+		if err := p.publish(queues[index], cbMessage); err != nil {
+			for _, unpublished := range messages[index:] {
+				failed := &GroupTaskResult{Error: err.Error()}
+				if _, _, err := backend.CompleteGroupTask(state.ID, unpublished.Group.Index, failed); err != nil {
+					return nil, err
+				}
+			}
+			if callback != nil {
+				stopChord(callback, cbMessage, err, p.setTaskResult)
+			}
+			return nil, err
+		}
+	}
+	return groupResult, nil
+}
+
+// stopChord store failure result of chord callback, which is not published because group task failed
+func stopChord(callback *ChainLink, cbMessage *CabbageMessage, err error, setTaskResult func(taskResult *TaskResult)) {
+	now := time.Now()
+	setTaskResult(&TaskResult{
+		ID:          callback.ID,
+		TaskName:    callback.TaskName,
+		State:       TaskStateFailure,
+		Error:       fmt.Sprintf("chord stopped: group task %s, id %s failed: %v", cbMessage.TaskName, cbMessage.ID, err),
+		PublishedAt: cbMessage.Timestamp,
+		FinishedAt:  &now,
+	})
+}
+
+// completeGroupTask store final result of group task, after last group task succeeded chord callback is published,
+// after first group task failed chord callback is stopped. Returns error if chord callback is not published and
+// group task can be retried, so callback is published by retried message; chord is stopped if group task has
+// no retry policy or its retries are used up
+func (w *CabbageWorker) completeGroupTask(cbMessage *CabbageMessage, result []byte, taskErr error) error {
+	if cbMessage.Group == nil {
+		return nil
+	}
+	if w.groupBackend == nil {
+		log.Printf("[!] Queue: %s, cant complete group %s task %s: %v", w.queueName, cbMessage.Group.GroupID, cbMessage.ID, ErrNoGroupBackend)
+		return nil
+	}
+	groupTaskResult := &GroupTaskResult{Success: taskErr == nil, Result: result}
+	if taskErr != nil {
+		groupTaskResult.Error = taskErr.Error()
+	}
+	progress, stored, err := w.groupBackend.CompleteGroupTask(cbMessage.Group.GroupID, cbMessage.Group.Index, groupTaskResult)
+	if err != nil {
+		log.Printf("[!] Queue: %s, cant complete group %s task %s: %+v", w.queueName, cbMessage.Group.GroupID, cbMessage.ID, err)
+		return nil
+	}
+	if stored {
+		// only worker, which stored first failure or last success, handles chord callback
+		if (taskErr != nil && progress.Failed != 1) || (taskErr == nil && progress.Succeeded != progress.Size) {
+			return nil
+		}
+	} else if taskErr != nil || progress.Succeeded != progress.Size {
+		// redelivered group task publishes callback again only if all group tasks succeeded
+		return nil
+	}
+	group, err := w.groupBackend.GetGroup(cbMessage.Group.GroupID)
+	if err != nil {
+		log.Printf("[!] Queue: %s, cant get group %s: %+v", w.queueName, cbMessage.Group.GroupID, err)
+		return nil
+	}
+	if group.Callback == nil {
+		return nil
+	}
+	if taskErr != nil {
+		stopChord(group.Callback, cbMessage, taskErr, w.setTaskResult)
+		return nil
+	}
+	if !stored && w.chordCallbackStarted(group.Callback) {
+		return nil
+	}
+	if err := w.publishChordCallback(cbMessage, group); err != nil {
+		log.Printf("[!] Queue: %s, cant publish chord callback of group %s: %+v", w.queueName, group.ID, err)
+		if !w.shouldRetry(cbMessage, err) {
+			stopChord(group.Callback, cbMessage, err, w.setTaskResult)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// succeededGroupTaskResult returns stored result of retried group task, which already succeeded
+func (w *CabbageWorker) succeededGroupTaskResult(cbMessage *CabbageMessage) ([]byte, bool) {
+	if cbMessage.Group == nil || cbMessage.Retries == 0 || w.groupBackend == nil {
+		return nil, false
+	}
+	group, err := w.groupBackend.GetGroup(cbMessage.Group.GroupID)
+	if err != nil || cbMessage.Group.Index < 0 || cbMessage.Group.Index >= len(group.Results) {
+		return nil, false
+	}
+	result := group.Results[cbMessage.Group.Index]
+	if result == nil || !result.Success {
+		return nil, false
+	}
+	return result.Result, true
+}
+
+// chordCallbackStarted checks that published chord callback is already received by worker, callback, which is
+// published but not started, is published again by redelivered group task
+func (w *CabbageWorker) chordCallbackStarted(callback *ChainLink) bool {
+	if w.resultBackend == nil {
+		return false
+	}
+	result, err := w.resultBackend.GetTaskResult(callback.ID)
+	return err == nil && result.State != TaskStatePending
+}
+
+// publishChordCallback publish chord callback task with json array of group tasks results as body
+func (w *CabbageWorker) publishChordCallback(cbMessage *CabbageMessage, group *GroupState) error {
+	results, err := groupResults(group)
+	if err != nil {
+		return err
+	}
+	body, err := chordCallbackBody(results)
+	if err != nil {
+		return err
+	}
+	callback := newCabbageMessage(group.Callback.TaskName, body)
+	callback.ID = group.Callback.ID
+	callback.Headers = copyHeaders(cbMessage.Headers)
+	if err := w.security.seal(callback); err != nil {
+		return err
+	}
+	return w.broker.SendCabbageMessage(group.Callback.QueueName, callback)
+}
+
+// MemoryGroupBackend is in-memory GroupBackend for tests and single-process deployments
+type MemoryGroupBackend struct {
+	lock   sync.Mutex
+	groups map[string]*GroupState
+}
+
+// NewMemoryGroupBackend create MemoryGroupBackend
+func NewMemoryGroupBackend() *MemoryGroupBackend {
+	return &MemoryGroupBackend{groups: make(map[string]*GroupState)}
+}
+
+// CreateGroup store new group
+func (b *MemoryGroupBackend) CreateGroup(group *GroupState) error {
+	cp := *group
+	cp.TaskIDs = append([]string(nil), group.TaskIDs...)
+	cp.Results = make([]*GroupTaskResult, group.Size)
+	b.lock.Lock()
+	b.groups[group.ID] = &cp
+	b.lock.Unlock()
+	return nil
+}
+
+// CompleteGroupTask store final result of group task
+func (b *MemoryGroupBackend) CompleteGroupTask(groupID string, index int, result *GroupTaskResult) (GroupProgress, bool, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	group, ok := b.groups[groupID]
+	if !ok {
+		return GroupProgress{}, false, ErrGroupNotFound
+	}
+	if index < 0 || index >= len(group.Results) {
+		return GroupProgress{}, false, fmt.Errorf("invalid group %s task index %d", groupID, index)
+	}
+	if group.Results[index] != nil {
+		return group.GroupProgress, false, nil
+	}
+	cp := *result
+	group.Results[index] = &cp
+	if result.Success {
+		group.Succeeded++
+	} else {
+		group.Failed++
+	}
+	return group.GroupProgress, true, nil
+}
+
+// GetGroup get group state
+func (b *MemoryGroupBackend) GetGroup(groupID string) (*GroupState, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	group, ok := b.groups[groupID]
+	if !ok {
+		return nil, ErrGroupNotFound
+	}
+	cp := *group
+	cp.Results = append([]*GroupTaskResult(nil), group.Results...)
+	return &cp, nil
+}
@@ -0,0 +1,218 @@
+package cabbage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// shardTestService returns shard id as result and fails shard with id "fail"
+type shardTestService struct{}
+
+func (s *shardTestService) ProccessTask(ctx context.Context, body []byte, ID string) error {
+	_, err := s.ProccessTaskWithResult(ctx, body, ID)
+	return err
+}
+
+func (s *shardTestService) ProccessTaskWithResult(ctx context.Context, body []byte, ID string) ([]byte, error) {
+	if strings.Contains(string(body), `"fail"`) {
+		return nil, NonRetryable(errors.New("shard error"))
+	}
+	return body, nil
+}
+
+// newShardsGroup create group of shard tasks
+func newShardsGroup(ids ...string) *Group {
+	group := NewGroup()
+	for _, id := range ids {
+		group.Tasks = append(group.Tasks, GroupTask{TaskName: "shard", TPublisher: &testSchData{ID: id}})
+	}
+	return group
+}
+
+func TestGroup(t *testing.T) {
+	client := startTasksTestClient(t, &Task{Name: "shard", QueueName: queueName, TProccesser: &shardTestService{}})
+	groupResult, err := client.publisher.PublishGroup(newShardsGroup("1", "2", "3"))
+	if err != nil {
+		t.Fatalf("cant publish group, %v", err)
+	}
+	if len(groupResult.Results) != 3 || groupResult.Callback != nil {
+		t.Fatalf("invalid group result %+v", groupResult)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	results, err := groupResult.Get(ctx)
+	if err != nil {
+		t.Fatalf("cant get group results, %v", err)
+	}
+	for index, id := range []string{"1", "2", "3"} {
+		if string(results[index]) != `{"id":"`+id+`","site_id":""}` {
+			t.Errorf("invalid result of group task %d: %s", index, results[index])
+		}
+	}
+	progress, err := groupResult.Progress()
+	if err != nil || progress != (GroupProgress{Size: 3, Succeeded: 3}) {
+		t.Errorf("invalid group progress %+v, %v", progress, err)
+	}
+}
+
+func TestChord(t *testing.T) {
+	client := startTasksTestClient(t,
+		&Task{Name: "shard", QueueName: queueName, TProccesser: &shardTestService{}},
+		&Task{Name: "aggregate", QueueName: queueName + "_chord", TProccesser: &resultTestService{}},
+	)
+	groupResult, err := client.publisher.PublishChord(newShardsGroup("1", "2"), "aggregate")
+	if err != nil {
+		t.Fatalf("cant publish chord, %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	result, err := groupResult.Callback.Get(ctx)
+	if err != nil {
+		t.Fatalf("cant get chord callback result, %v", err)
+	}
+	if string(result) != `result:[{"id":"1","site_id":""},{"id":"2","site_id":""}]` {
+		t.Errorf("chord callback must receive results of all group tasks, got %s", result)
+	}
+}
+
+func TestChordFailure(t *testing.T) {
+	client := startTasksTestClient(t,
+		&Task{Name: "shard", QueueName: queueName, TProccesser: &shardTestService{}},
+		&Task{Name: "aggregate", QueueName: queueName, TProccesser: &resultTestService{}},
+	)
+	groupResult, err := client.publisher.PublishChord(newShardsGroup("1", "fail", "3"), "aggregate")
+	if err != nil {
+		t.Fatalf("cant publish chord, %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err = groupResult.Get(ctx)
+	var failedErr *TaskFailedError
+	if !errors.As(err, &failedErr) || failedErr.ID != groupResult.Results[1].ID {
+		t.Fatalf("group must fail with error of failed task, got %v", err)
+	}
+	callback, err := groupResult.Callback.Wait(time.Second)
+	if err != nil || callback.State != TaskStateFailure || !strings.Contains(callback.Error, "chord stopped") {
+		t.Errorf("chord callback must be stopped, got %+v, %v", callback, err)
+	}
+}
+
+// failingSendBroker memory broker which fails sending of failures messages to queue
+type failingSendBroker struct {
+	*MemoryBroker
+	lock      sync.Mutex
+	queueName string
+	failures  int
+}
+
+func (b *failingSendBroker) SendCabbageMessage(queueName string, cbMessage *CabbageMessage) error {
+	b.lock.Lock()
+	if queueName == b.queueName && b.failures > 0 {
+		b.failures--
+		b.lock.Unlock()
+		return errors.New("send error")
+	}
+	b.lock.Unlock()
+	return b.MemoryBroker.SendCabbageMessage(queueName, cbMessage)
+}
+
+// countingShardTestService shardTestService which counts runs of tasks
+type countingShardTestService struct {
+	shardTestService
+	runs atomic.Int32
+}
+
+func (s *countingShardTestService) ProccessTaskWithResult(ctx context.Context, body []byte, ID string) ([]byte, error) {
+	s.runs.Add(1)
+	return s.shardTestService.ProccessTaskWithResult(ctx, body, ID)
+}
+
+func TestChordCallbackPublishFailure(t *testing.T) {
+	broker := &failingSendBroker{MemoryBroker: NewMemoryBroker(), queueName: queueName + "_chord", failures: 2}
+	service := &countingShardTestService{}
+	client := startBrokerTasksTestClient(t, broker,
+		&Task{Name: "shard", QueueName: queueName, TProccesser: service, RetryPolicy: NewRetryPolicy(5, nil)},
+		&Task{Name: "aggregate", QueueName: queueName + "_chord", TProccesser: &resultTestService{}},
+	)
+	groupResult, err := client.publisher.PublishChord(newShardsGroup("1", "2"), "aggregate")
+	if err != nil {
+		t.Fatalf("cant publish chord, %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	result, err := groupResult.Callback.Get(ctx)
+	if err != nil {
+		t.Fatalf("chord callback must be published by retried last group task, got %v", err)
+	}
+	if string(result) != `result:[{"id":"1","site_id":""},{"id":"2","site_id":""}]` {
+		t.Errorf("invalid chord callback result %s", result)
+	}
+	if runs := service.runs.Load(); runs != 2 {
+		t.Errorf("retried group task must not be run again, got %d runs", runs)
+	}
+}
+
+func TestChordCallbackPublishRetriesExhausted(t *testing.T) {
+	for name, retryPolicy := range map[string]*RetryPolicy{"retries used up": NewRetryPolicy(2, nil), "no retry policy": nil} {
+		t.Run(name, func(t *testing.T) {
+			broker := &failingSendBroker{MemoryBroker: NewMemoryBroker(), queueName: queueName + "_chord", failures: 100}
+			service := &countingShardTestService{}
+			client := startBrokerTasksTestClient(t, broker,
+				&Task{Name: "shard", QueueName: queueName, TProccesser: service, RetryPolicy: retryPolicy},
+				&Task{Name: "aggregate", QueueName: queueName + "_chord", TProccesser: &resultTestService{}},
+			)
+			groupResult, err := client.publisher.PublishChord(newShardsGroup("1"), "aggregate")
+			if err != nil {
+				t.Fatalf("cant publish chord, %v", err)
+			}
+			callback, err := groupResult.Callback.Wait(2 * time.Second)
+			if err != nil || callback.State != TaskStateFailure || !strings.Contains(callback.Error, "chord stopped") {
+				t.Errorf("chord callback must be stopped, got %+v, %v", callback, err)
+			}
+			// message of group task is acknowledged, so task is not run again
+			time.Sleep(100 * time.Millisecond)
+			if runs := service.runs.Load(); runs != 1 {
+				t.Errorf("group task must be run once, got %d runs", runs)
+			}
+		})
+	}
+}
+
+func TestMemoryGroupBackend(t *testing.T) {
+	testGroupBackend(t, NewMemoryGroupBackend())
+}
+
+// testGroupBackend checks that group task result is stored only once
+func testGroupBackend(t *testing.T, backend GroupBackend) {
+	group := &GroupState{ID: newCabbageMessage(taskName, nil).ID, TaskIDs: []string{"a", "b"}, GroupProgress: GroupProgress{Size: 2}}
+	if err := backend.CreateGroup(group); err != nil {
+		t.Fatalf("cant create group, %v", err)
+	}
+	progress, stored, err := backend.CompleteGroupTask(group.ID, 0, &GroupTaskResult{Success: true, Result: []byte("a")})
+	if err != nil || !stored || progress != (GroupProgress{Size: 2, Succeeded: 1}) {
+		t.Fatalf("invalid group progress %+v, %v, %v", progress, stored, err)
+	}
+	// redelivered group task does not change progress
+	progress, stored, err = backend.CompleteGroupTask(group.ID, 0, &GroupTaskResult{Error: "redelivered"})
+	if err != nil || stored || progress.Failed != 0 {
+		t.Errorf("repeated result must not be stored, got %+v, %v, %v", progress, stored, err)
+	}
+	if _, _, err := backend.CompleteGroupTask(group.ID, 2, &GroupTaskResult{Success: true}); err == nil {
+		t.Error("result of task out of group must not be stored")
+	}
+	if _, _, err := backend.CompleteGroupTask("missing", 0, &GroupTaskResult{Success: true}); err != ErrGroupNotFound {
+		t.Errorf("expected ErrGroupNotFound, got %v", err)
+	}
+	state, err := backend.GetGroup(group.ID)
+	if err != nil {
+		t.Fatalf("cant get group, %v", err)
+	}
+	if state.Done() || string(state.Results[0].Result) != "a" || state.Results[1] != nil || state.TaskIDs[1] != "b" {
+		t.Errorf("invalid group state %+v", state)
+	}
+}
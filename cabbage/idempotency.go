@@ -0,0 +1,81 @@
+package cabbage
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// IdempotencyStore is interface for processed task messages IDs storage, store must be shared by workers.
+// Processed IDs expire after store TTL
+type IdempotencyStore interface {
+	// MarkProcessed record that task message is processed successfully
+	MarkProcessed(ID string) error
+	// IsProcessed checks that task message is already processed
+	IsProcessed(ID string) (bool, error)
+}
+
+// isProcessed checks that message task is already processed, store errors are logged and message is proccessed
+func (w *CabbageWorker) isProcessed(cbMessage *CabbageMessage) bool {
+	if w.idempotencyStore == nil {
+		return false
+	}
+	processed, err := w.idempotencyStore.IsProcessed(cbMessage.ID)
+	if err != nil {
+		log.Printf("[!] Queue: %s, cant check that task message %s is processed: %+v", w.queueName, cbMessage.ID, err)
+		return false
+	}
+	return processed
+}
+
+// markProcessed record that message task is processed successfully
+func (w *CabbageWorker) markProcessed(cbMessage *CabbageMessage) {
+	if w.idempotencyStore == nil {
+		return
+	}
+	if err := w.idempotencyStore.MarkProcessed(cbMessage.ID); err != nil {
+		log.Printf("[!] Queue: %s, cant mark task message %s as processed: %+v", w.queueName, cbMessage.ID, err)
+	}
+}
+
+// MemoryIdempotencyStore is in-memory IdempotencyStore for tests and single-process deployments
+type MemoryIdempotencyStore struct {
+	lock      sync.Mutex
+	ttl       time.Duration
+	processed map[string]time.Time // processed IDs with expiration time, zero time - never expires
+}
+
+// NewMemoryIdempotencyStore create MemoryIdempotencyStore, processed IDs expire after ttl (0 - never)
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{ttl: ttl, processed: make(map[string]time.Time)}
+}
+
+// MarkProcessed record that task message is processed
+func (s *MemoryIdempotencyStore) MarkProcessed(ID string) error {
+	now := time.Now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// expired IDs are removed on write, so store does not grow
+	for processedID, expiresAt := range s.processed {
+		if !expiresAt.IsZero() && !expiresAt.After(now) {
+			delete(s.processed, processedID)
+		}
+	}
+	var expiresAt time.Time
+	if s.ttl > 0 {
+		expiresAt = now.Add(s.ttl)
+	}
+	s.processed[ID] = expiresAt
+	return nil
+}
+
+// IsProcessed checks that task message is processed
+func (s *MemoryIdempotencyStore) IsProcessed(ID string) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	expiresAt, ok := s.processed[ID]
+	if !ok || (!expiresAt.IsZero() && !expiresAt.After(time.Now())) {
+		return false, nil
+	}
+	return true, nil
+}
@@ -0,0 +1,62 @@
+package cabbage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkerIdempotency(t *testing.T) {
+	broker := &ackRecordingBroker{MemoryBroker: NewMemoryBroker()}
+	client := NewCabbageClient(broker)
+	defer client.Close()
+	client.SetIdempotencyStore(NewMemoryIdempotencyStore(time.Minute))
+	worker, _ := client.CreateWorker(queueName, 1)
+	service := &flakyTestService{failures: 1, attempts: make(chan int, 10)}
+	worker.RegisterTask(&Task{Name: taskName, QueueName: queueName, TProccesser: service, RetryPolicy: NewRetryPolicy(3, NewFixedBackoff(10*time.Millisecond))})
+	worker.StartWorker()
+	defer worker.StopWorker()
+	redelivered := newCabbageMessage(taskName, body)
+	broker.SendCabbageMessage(queueName, redelivered)
+	// failed attempt is not recorded, so task is retried
+	for expected := 1; expected <= 2; expected++ {
+		select {
+		case attempt := <-service.attempts:
+			if attempt != expected {
+				t.Fatalf("invalid attempt %d, must be %d", attempt, expected)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("attempt %d was not proccessed", expected)
+		}
+	}
+	// failed attempt and retry message are acknowledged
+	waitFor(t, func() bool { return broker.ackedCount() == 2 })
+	broker.SendCabbageMessage(queueName, redelivered)
+	waitFor(t, func() bool { return broker.ackedCount() == 3 })
+	if len(service.attempts) != 0 {
+		t.Error("processed message must not be proccessed again")
+	}
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	testIdempotencyStore(t, NewMemoryIdempotencyStore(time.Minute))
+	store := NewMemoryIdempotencyStore(time.Millisecond)
+	store.MarkProcessed("expired")
+	time.Sleep(5 * time.Millisecond)
+	if processed, _ := store.IsProcessed("expired"); processed {
+		t.Error("processed ID must expire")
+	}
+}
+
+// testIdempotencyStore checks that processed ID is recorded
+func testIdempotencyStore(t *testing.T, store IdempotencyStore) {
+	ID := newCabbageMessage(taskName, nil).ID
+	if processed, err := store.IsProcessed(ID); err != nil || processed {
+		t.Fatalf("message must not be processed, got %v, %v", processed, err)
+	}
+	if err := store.MarkProcessed(ID); err != nil {
+		t.Fatalf("cant mark message as processed, %v", err)
+	}
+	if processed, err := store.IsProcessed(ID); err != nil || !processed {
+		t.Errorf("message must be processed, got %v, %v", processed, err)
+	}
+}
@@ -0,0 +1,318 @@
+package cabbage
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueEmpty returned by MemoryBroker when queue has no messages
+	ErrQueueEmpty = errors.New("queue is empty")
+	// ErrBrokerClosed returned by MemoryBroker after Close
+	ErrBrokerClosed = errors.New("broker is closed")
+)
+
+// MemoryBroker is in-memory cabbage broker for tests and single-process deployments
+type MemoryBroker struct {
+	lock   sync.Mutex
+	queues map[string]*memoryQueue
+	done   chan struct{}
+	closed bool
+}
+
+// memoryQueue FIFO queue of cabbage messages
+type memoryQueue struct {
+	messages []*CabbageMessage
+	delayed  []*CabbageMessage // sorted by ETA
+	ready    chan struct{}
+}
+
+// NewMemoryBroker create new MemoryBroker
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		queues: make(map[string]*memoryQueue),
+		done:   make(chan struct{}),
+	}
+}
+
+// queue get or create queue by name, must be called under lock
+func (b *MemoryBroker) queue(queueName string) *memoryQueue {
+	q, ok := b.queues[queueName]
+	if !ok {
+		q = &memoryQueue{ready: make(chan struct{}, 1)}
+		b.queues[queueName] = q
+	}
+	return q
+}
+
+// signal wakes up one waiting receiver, must be called under lock
+func (q *memoryQueue) signal() {
+	if len(q.messages) == 0 {
+		return
+	}
+	q.wake()
+}
+
+// wake wakes up one waiting receiver
+func (q *memoryQueue) wake() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// push add message to queue, delayed message is added to queue on its ETA, must be called under lock
+func (q *memoryQueue) push(cbMessage *CabbageMessage) {
+	if !cbMessage.isDelayed(time.Now()) {
+		q.messages = append(q.messages, cbMessage)
+		q.signal()
+		return
+	}
+	i := sort.Search(len(q.delayed), func(i int) bool {
+		return q.delayed[i].ETA.After(*cbMessage.ETA)
+	})
+	q.delayed = append(q.delayed, nil)
+	copy(q.delayed[i+1:], q.delayed[i:])
+	q.delayed[i] = cbMessage
+	// waiting receiver must recalculate next ETA
+	q.wake()
+}
+
+// promote move delayed messages with passed ETA to queue, must be called under lock
+func (q *memoryQueue) promote(now time.Time) {
+	i := 0
+	for ; i < len(q.delayed) && !q.delayed[i].isDelayed(now); i++ {
+		q.messages = append(q.messages, q.delayed[i])
+		q.delayed[i] = nil
+	}
+	q.delayed = q.delayed[i:]
+}
+
+// nextETA returns duration till nearest delayed message ETA, must be called under lock
+func (q *memoryQueue) nextETA(now time.Time) (time.Duration, bool) {
+	if len(q.delayed) == 0 {
+		return 0, false
+	}
+	return q.delayed[0].ETA.Sub(now), true
+}
+
+// wait waits for queue signal, delayed message ETA, context or broker close
+func (q *memoryQueue) wait(ctx context.Context, done chan struct{}, delay time.Duration, delayed bool) error {
+	var etaC <-chan time.Time
+	if delayed {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		etaC = timer.C
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		return ErrBrokerClosed
+	case <-q.ready:
+	case <-etaC:
+	}
+	return nil
+}
+
+// pop get first message from queue, must be called under lock
+func (q *memoryQueue) pop() *CabbageMessage {
+	q.promote(time.Now())
+	if len(q.messages) == 0 {
+		return nil
+	}
+	cbMessage := q.messages[0]
+	q.messages[0] = nil
+	q.messages = q.messages[1:]
+	q.signal()
+	return cbMessage
+}
+
+// EnableQueueForWorker create queue
+func (b *MemoryBroker) EnableQueueForWorker(queueName string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	b.queue(queueName)
+	return nil
+}
+
+// Close memory broker, blocked receivers are released
+func (b *MemoryBroker) Close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	close(b.done)
+}
+
+// SendCabbageMessage send cabbage message to memory broker
+func (b *MemoryBroker) SendCabbageMessage(queueName string, cbMessage *CabbageMessage) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	b.queue(queueName).push(copyCabbageMessage(cbMessage))
+	return nil
+}
+
+// GetCabbageMessage get cabbage message from memory broker, returns ErrQueueEmpty if queue is empty
+func (b *MemoryBroker) GetCabbageMessage(queueName string) (*CabbageMessage, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return nil, ErrBrokerClosed
+	}
+	cbMessage := b.queue(queueName).pop()
+	if cbMessage == nil {
+		return nil, ErrQueueEmpty
+	}
+	return cbMessage, nil
+}
+
+// GetCabbageMessageWithContext get cabbage message from memory broker, blocks until message arrives or context is done
+func (b *MemoryBroker) GetCabbageMessageWithContext(ctx context.Context, queueName string) (*CabbageMessage, error) {
+	for {
+		b.lock.Lock()
+		if b.closed {
+			b.lock.Unlock()
+			return nil, ErrBrokerClosed
+		}
+		q := b.queue(queueName)
+		cbMessage := q.pop()
+		delay, delayed := q.nextETA(time.Now())
+		b.lock.Unlock()
+		if cbMessage != nil {
+			return cbMessage, nil
+		}
+		if err := q.wait(ctx, b.done, delay, delayed); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// AckCabbageMessage confirms received message, message is already removed from memory broker
+func (b *MemoryBroker) AckCabbageMessage(queueName string, cbMessage *CabbageMessage) error {
+	return nil
+}
+
+// NackCabbageMessage returns message to queue head if requeue, otherwise sends it to dead letter queue
+func (b *MemoryBroker) NackCabbageMessage(queueName string, cbMessage *CabbageMessage, requeue bool) error {
+	if !requeue {
+		return b.SendDeadLetter(queueName, newDeadLetterMessage(cbMessage, DeadLetterReasonRejected, nil))
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	q := b.queue(queueName)
+	q.messages = append([]*CabbageMessage{copyCabbageMessage(cbMessage)}, q.messages...)
+	q.signal()
+	return nil
+}
+
+// RejectCabbageMessage same as NackCabbageMessage for memory broker
+func (b *MemoryBroker) RejectCabbageMessage(queueName string, cbMessage *CabbageMessage, requeue bool) error {
+	return b.NackCabbageMessage(queueName, cbMessage, requeue)
+}
+
+// SendDeadLetter send cabbage message to queue dead letter queue
+func (b *MemoryBroker) SendDeadLetter(queueName string, cbMessage *CabbageMessage) error {
+	return b.SendCabbageMessage(deadLetterQueueName(queueName), cbMessage)
+}
+
+// GetDeadLetters returns up to limit messages from queue dead letter queue
+func (b *MemoryBroker) GetDeadLetters(queueName string, limit int) ([]*CabbageMessage, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return nil, ErrBrokerClosed
+	}
+	q := b.queue(deadLetterQueueName(queueName))
+	if limit <= 0 || limit > len(q.messages) {
+		limit = len(q.messages)
+	}
+	messages := make([]*CabbageMessage, 0, limit)
+	for _, cbMessage := range q.messages[:limit] {
+		messages = append(messages, copyCabbageMessage(cbMessage))
+	}
+	return messages, nil
+}
+
+// RequeueDeadLetters move all messages from dead letter queue back to queue
+func (b *MemoryBroker) RequeueDeadLetters(queueName string) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return 0, ErrBrokerClosed
+	}
+	dlq := b.queue(deadLetterQueueName(queueName))
+	q := b.queue(queueName)
+	count := len(dlq.messages)
+	for _, cbMessage := range dlq.messages {
+		q.messages = append(q.messages, newRequeuedMessage(cbMessage))
+	}
+	dlq.messages = nil
+	q.signal()
+	return count, nil
+}
+
+// PurgeDeadLetters remove all messages from queue dead letter queue
+func (b *MemoryBroker) PurgeDeadLetters(queueName string) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return 0, ErrBrokerClosed
+	}
+	dlq := b.queue(deadLetterQueueName(queueName))
+	count := len(dlq.messages)
+	dlq.messages = nil
+	return count, nil
+}
+
+// Len returns number of messages in queue, delayed messages are not counted before their ETA
+func (b *MemoryBroker) Len(queueName string) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	q, ok := b.queues[queueName]
+	if !ok {
+		return 0
+	}
+	q.promote(time.Now())
+	return len(q.messages)
+}
+
+// copyCabbageMessage copy message, so publisher and consumer dont share memory
+func copyCabbageMessage(cbMessage *CabbageMessage) *CabbageMessage {
+	cp := *cbMessage
+	cp.receipt = nil
+	if cbMessage.Body != nil {
+		cp.Body = append([]byte(nil), cbMessage.Body...)
+	}
+	if cbMessage.DeadLetter != nil {
+		deadLetter := *cbMessage.DeadLetter
+		cp.DeadLetter = &deadLetter
+	}
+	if cbMessage.ETA != nil {
+		eta := *cbMessage.ETA
+		cp.ETA = &eta
+	}
+	cp.Headers = copyHeaders(cbMessage.Headers)
+	if cbMessage.Group != nil {
+		group := *cbMessage.Group
+		cp.Group = &group
+	}
+	if cbMessage.Chain != nil {
+		cp.Chain = append([]ChainLink(nil), cbMessage.Chain...)
+	}
+	return &cp
+}
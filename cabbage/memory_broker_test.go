@@ -0,0 +1,140 @@
+package cabbage
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryBrokerFIFO(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	testBrokerOrdering(t, broker, queueName, 5, false)
+	if _, err := broker.GetCabbageMessage(queueName); err != ErrQueueEmpty {
+		t.Errorf("expected ErrQueueEmpty, got %v", err)
+	}
+}
+
+func TestMemoryBrokerBlockingReceive(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		broker.SendCabbageMessage(queueName, cbMessage)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err := broker.GetCabbageMessageWithContext(ctx, queueName)
+	if err != nil {
+		t.Fatalf("cant get cb message from memory broker, %v", err)
+	}
+	if msg.ID != cbMessage.ID {
+		t.Log("Invalid ids in memory broker")
+		t.Fail()
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := broker.GetCabbageMessageWithContext(ctx, queueName); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		broker.Close()
+	}()
+	if _, err := broker.GetCabbageMessageWithContext(context.Background(), queueName); err != ErrBrokerClosed {
+		t.Errorf("expected ErrBrokerClosed, got %v", err)
+	}
+}
+
+func TestMemoryBrokerConcurrency(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	const producers, perProducer = 4, 250
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var lock sync.Mutex
+	received := make(map[string]int)
+	var consumersWG sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		consumersWG.Add(1)
+		go func() {
+			defer consumersWG.Done()
+			for {
+				msg, err := broker.GetCabbageMessageWithContext(ctx, queueName)
+				if err != nil {
+					return
+				}
+				lock.Lock()
+				received[msg.ID]++
+				done := len(received) == producers*perProducer
+				lock.Unlock()
+				if done {
+					cancel()
+				}
+			}
+		}()
+	}
+	var producersWG sync.WaitGroup
+	for i := 0; i < producers; i++ {
+		producersWG.Add(1)
+		go func() {
+			defer producersWG.Done()
+			for j := 0; j < perProducer; j++ {
+				broker.SendCabbageMessage(queueName, newCabbageMessage(taskName, body))
+			}
+		}()
+	}
+	producersWG.Wait()
+	consumersWG.Wait()
+	if len(received) != producers*perProducer {
+		t.Fatalf("expected %d messages, got %d", producers*perProducer, len(received))
+	}
+	for id, count := range received {
+		if count != 1 {
+			t.Errorf("message %s received %d times", id, count)
+		}
+	}
+}
+
+type memoryTestService struct {
+	received chan string
+}
+
+func (s *memoryTestService) ProccessTask(ctx context.Context, body []byte, ID string) error {
+	s.received <- string(body)
+	return nil
+}
+
+func TestMemoryBrokerWorkerAndPublisher(t *testing.T) {
+	client := NewCabbageClient(NewMemoryBroker())
+	defer client.Close()
+	worker, err := client.CreateWorker(queueName, 2)
+	if err != nil {
+		t.Fatalf("cant create worker, %v", err)
+	}
+	publisher := client.CreatePublisher()
+	service := &memoryTestService{received: make(chan string, 1)}
+	task, _ := NewTask(taskName, queueName, service, true)
+	if err := client.RegisterTask(task); err != nil {
+		t.Fatalf("cant register task, %v", err)
+	}
+	if err := worker.StartWorker(); err != nil {
+		t.Fatalf("cant start worker, %v", err)
+	}
+	defer worker.StopWorker()
+	if _, err := publisher.PublishTask(taskName, &testSchData{ID: "memory"}); err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	select {
+	case got := <-service.received:
+		if got != `{"id":"memory","site_id":""}` {
+			t.Errorf("invalid body %s", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("task was not proccessed")
+	}
+}
@@ -1,6 +1,9 @@
 package cabbage
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	uuid "github.com/satori/go.uuid"
@@ -8,11 +11,21 @@ import (
 
 // CabbageMessage base message for publish\consume
 type CabbageMessage struct {
-	ID        string    `json:"id"`
-	MessageId string    `json:"messageId"`
-	Body      []byte    `json:"body"`
-	TaskName  string    `json:"TaskName"`
-	Timestamp time.Time `json:"timestamp"`
+	ID              string            `json:"id"`
+	MessageId       string            `json:"messageId"`
+	Body            []byte            `json:"body"`
+	TaskName        string            `json:"TaskName"`
+	Timestamp       time.Time         `json:"timestamp"`
+	Retries         int               `json:"retries"`
+	DeadLetter      *DeadLetter       `json:"deadLetter,omitempty"`
+	ETA             *time.Time        `json:"eta,omitempty"`             // message is delivered to workers not earlier than ETA
+	Timeout         time.Duration     `json:"timeout,omitempty"`         // overrides task soft timeout
+	Headers         map[string]string `json:"headers,omitempty"`         // message metadata: correlation id, tenant, trace context, etc.
+	ContentType     string            `json:"contentType,omitempty"`     // content type of body, empty for legacy json messages
+	ContentEncoding string            `json:"contentEncoding,omitempty"` // compression of body, empty for not compressed body
+	Chain           []ChainLink       `json:"chain,omitempty"`           // next chain tasks, published after task success
+	Group           *GroupMember      `json:"group,omitempty"`           // group of task, group state is stored in GroupBackend
+	receipt         interface{}       // broker specific data of received message, used for ack
 }
 
 // newCabbageMessage create cabbage message
@@ -26,3 +39,56 @@ func newCabbageMessage(taskName string, body []byte) *CabbageMessage {
 	}
 	return cbMessage
 }
+
+// newRetryMessage create copy of cabbage message for next retry
+func newRetryMessage(cbMessage *CabbageMessage) *CabbageMessage {
+	retryMessage := *cbMessage
+	retryMessage.MessageId = uuid.NewV4().String()
+	retryMessage.Retries++
+	retryMessage.ETA = nil
+	retryMessage.receipt = nil
+	return &retryMessage
+}
+
+// isDelayed checks that message ETA is after now
+func (cbMessage *CabbageMessage) isDelayed(now time.Time) bool {
+	return cbMessage.ETA != nil && cbMessage.ETA.After(now)
+}
+
+// copyHeaders copy message headers
+func copyHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	cp := make(map[string]string, len(headers))
+	for key, value := range headers {
+		cp[key] = value
+	}
+	return cp
+}
+
+// ErrReservedHeader returned when published message header is used by cabbage or broker
+var ErrReservedHeader = errors.New("reserved message header")
+
+// reservedHeaderPrefixes prefixes of headers used by cabbage and brokers, which cant be message headers
+var reservedHeaderPrefixes = []string{"x-cabbage-", "x-death", "x-first-death-", "x-last-death-"}
+
+// isReservedHeader checks that header is used by cabbage or broker and cant be message header
+func isReservedHeader(key string) bool {
+	for _, prefix := range reservedHeaderPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateHeaders checks that message headers are not reserved, so headers are same on all brokers
+func validateHeaders(headers map[string]string) error {
+	for key := range headers {
+		if isReservedHeader(key) {
+			return fmt.Errorf("%w %s", ErrReservedHeader, key)
+		}
+	}
+	return nil
+}
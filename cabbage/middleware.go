@@ -0,0 +1,38 @@
+package cabbage
+
+import "context"
+
+// TaskProccesserFunc adapter to use ordinary function as TaskProccesser
+type TaskProccesserFunc func(ctx context.Context, body []byte, ID string) error
+
+// ProccessTask calls f(ctx, body, ID)
+func (f TaskProccesserFunc) ProccessTask(ctx context.Context, body []byte, ID string) error {
+	return f(ctx, body, ID)
+}
+
+// Middleware wraps task proccesser with cross-cutting logic, proccessed message is available
+// in middleware with CabbageMessageFromContext
+type Middleware func(next TaskProccesser) TaskProccesser
+
+// chainMiddlewares wraps task proccesser with middlewares, first middleware is outermost
+func chainMiddlewares(tp TaskProccesser, middlewares []Middleware) TaskProccesser {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		tp = middlewares[i](tp)
+	}
+	return tp
+}
+
+// PublishHandler sends cabbage message to broker queue
+type PublishHandler func(queueName string, cbMessage *CabbageMessage) error
+
+// PublishInterceptor wraps publishing of task message, interceptor can modify message
+// or stop publishing by returning error
+type PublishInterceptor func(next PublishHandler) PublishHandler
+
+// chainPublishInterceptors wraps publish handler with interceptors, first interceptor is outermost
+func chainPublishInterceptors(handler PublishHandler, interceptors []PublishInterceptor) PublishHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		handler = interceptors[i](handler)
+	}
+	return handler
+}
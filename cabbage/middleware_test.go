@@ -0,0 +1,132 @@
+package cabbage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingMiddleware returns middleware, which records its name and proccessed message to calls
+func recordingMiddleware(name string, lock *sync.Mutex, calls *[]string) Middleware {
+	return func(next TaskProccesser) TaskProccesser {
+		return TaskProccesserFunc(func(ctx context.Context, body []byte, ID string) error {
+			cbMessage := CabbageMessageFromContext(ctx)
+			lock.Lock()
+			*calls = append(*calls, name+":"+cbMessage.TaskName)
+			lock.Unlock()
+			return next.ProccessTask(ctx, body, ID)
+		})
+	}
+}
+
+func TestWorkerMiddlewares(t *testing.T) {
+	client := NewCabbageClient(NewMemoryBroker())
+	defer client.Close()
+	client.SetResultBackend(NewMemoryResultBackend())
+	worker, _ := client.CreateWorker(queueName, 1)
+	client.CreatePublisher()
+
+	var lock sync.Mutex
+	var calls []string
+	worker.Use(recordingMiddleware("worker1", &lock, &calls), recordingMiddleware("worker2", &lock, &calls))
+	task := &Task{Name: taskName, QueueName: queueName, TProccesser: &resultTestService{}, WithPublish: true}
+	task.Middlewares = []Middleware{recordingMiddleware("task", &lock, &calls)}
+	client.RegisterTask(task)
+	if err := worker.StartWorker(); err != nil {
+		t.Fatalf("cant start worker, %v", err)
+	}
+	defer worker.StopWorker()
+
+	asyncResult, err := client.publisher.PublishTask(taskName, &testSchData{ID: "ok"})
+	if err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	result, err := asyncResult.Get(ctx)
+	if err != nil {
+		t.Fatalf("cant get task result, %v", err)
+	}
+	if string(result) != `result:{"id":"ok","site_id":""}` {
+		t.Errorf("result must be passed through middlewares, got %s", result)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	expected := []string{"worker1:" + taskName, "worker2:" + taskName, "task:" + taskName}
+	if len(calls) != len(expected) {
+		t.Fatalf("invalid middleware calls %v", calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Errorf("invalid middleware calls order %v", calls)
+		}
+	}
+}
+
+func TestWorkerMiddlewareError(t *testing.T) {
+	service := &countingTestService{count: make(chan struct{}, 1)}
+	task := &Task{Name: taskName, QueueName: queueName, TProccesser: service}
+	task.Middlewares = []Middleware{func(next TaskProccesser) TaskProccesser {
+		return TaskProccesserFunc(func(ctx context.Context, body []byte, ID string) error {
+			return errors.New("unauthorized")
+		})
+	}}
+	client, _ := startTestWorker(t, task)
+	if _, err := client.publisher.PublishTask(taskName, &testSchData{ID: "denied"}); err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	deadLetter := waitDeadLetter(t, client.broker.(*MemoryBroker))
+	if deadLetter.DeadLetter.Error != "unauthorized" {
+		t.Errorf("invalid dead letter error %s", deadLetter.DeadLetter.Error)
+	}
+	if len(service.count) != 0 {
+		t.Error("task proccesser must not be called")
+	}
+}
+
+func TestPublisherInterceptors(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	publisher := newTestPublisher(broker)
+	errInvalid := errors.New("invalid payload")
+	publisher.Use(
+		func(next PublishHandler) PublishHandler {
+			return func(queueName string, cbMessage *CabbageMessage) error {
+				if len(cbMessage.Body) == 0 {
+					return errInvalid
+				}
+				return next(queueName, cbMessage)
+			}
+		},
+		func(next PublishHandler) PublishHandler {
+			return func(queueName string, cbMessage *CabbageMessage) error {
+				cbMessage.Timeout = time.Minute
+				return next(queueName, cbMessage)
+			}
+		},
+	)
+	if _, err := publisher.PublishTask(taskName, &testSchData{ID: "intercepted"}); err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	msg, err := broker.GetCabbageMessage(queueName)
+	if err != nil {
+		t.Fatalf("cant get message, %v", err)
+	}
+	if msg.Timeout != time.Minute {
+		t.Errorf("message must be modified by interceptor, timeout %s", msg.Timeout)
+	}
+	if _, err := publisher.PublishTask(taskName, emptyTestPublisher{}); err != errInvalid {
+		t.Fatalf("interceptor must stop publishing, got %v", err)
+	}
+	if broker.Len(queueName) != 0 {
+		t.Error("rejected message must not be sent")
+	}
+}
+
+type emptyTestPublisher struct{}
+
+func (emptyTestPublisher) ToPublish() ([]byte, error) {
+	return nil, nil
+}
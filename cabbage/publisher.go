@@ -2,7 +2,9 @@ package cabbage
 
 import (
 	"errors"
+	"log"
 	"sync"
+	"time"
 )
 
 // Publisher cabbage task publisher
@@ -10,6 +12,91 @@ type Publisher struct {
 	broker         CabbageBroker
 	taskLock       sync.RWMutex
 	registredTasks map[string]*Task
+	resultBackend  ResultBackend
+	interceptors   []PublishInterceptor
+	codec          Codec
+	compression    *compression
+	security       *SecurityConfig
+	groupBackend   GroupBackend
+	dedupStore     DedupStore
+}
+
+// PublishOption configures published task message
+type PublishOption func(o *publishOptions)
+
+// publishOptions options of published task message
+type publishOptions struct {
+	eta         *time.Time
+	timeout     time.Duration
+	headers     map[string]string
+	contentType string
+	uniqueKey   string
+	uniqueTTL   time.Duration
+}
+
+// newPublishOptions apply PublishOption slice
+func newPublishOptions(opts []PublishOption) *publishOptions {
+	o := &publishOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// apply options to cabbage message
+func (o *publishOptions) apply(cbMessage *CabbageMessage) {
+	cbMessage.ETA = o.eta
+	cbMessage.Timeout = o.timeout
+	cbMessage.Headers = o.headers
+	cbMessage.ContentType = o.contentType
+}
+
+// Countdown delays task execution: message is delivered to workers after duration
+func Countdown(d time.Duration) PublishOption {
+	return func(o *publishOptions) {
+		eta := time.Now().Add(d)
+		o.eta = &eta
+	}
+}
+
+// ETA delays task execution: message is delivered to workers not earlier than eta
+func ETA(eta time.Time) PublishOption {
+	return func(o *publishOptions) {
+		o.eta = &eta
+	}
+}
+
+// Timeout overrides task soft timeout for published message
+func Timeout(timeout time.Duration) PublishOption {
+	return func(o *publishOptions) {
+		o.timeout = timeout
+	}
+}
+
+// Header set published message header
+func Header(key, value string) PublishOption {
+	return func(o *publishOptions) {
+		if o.headers == nil {
+			o.headers = make(map[string]string)
+		}
+		o.headers[key] = value
+	}
+}
+
+// Headers set published message headers
+func Headers(headers map[string]string) PublishOption {
+	return func(o *publishOptions) {
+		for key, value := range headers {
+			Header(key, value)(o)
+		}
+	}
+}
+
+// ContentType set content type of published message body
+func ContentType(contentType string) PublishOption {
+	return func(o *publishOptions) {
+		o.contentType = contentType
+	}
 }
 
 // newPublisher create Publisher
@@ -17,23 +104,145 @@ func newPublisher(broker CabbageBroker) *Publisher {
 	return &Publisher{broker: broker, registredTasks: make(map[string]*Task)}
 }
 
-// PublishTask publish task to broker
-func (p *Publisher) PublishTask(taskName string, tpublisher TaskPublisher) error {
+// PublishTask publish task to broker, returns AsyncResult for awaiting task result.
+// Returns DuplicateTaskError if unique task is already published within dedup window
+func (p *Publisher) PublishTask(taskName string, tpublisher TaskPublisher, opts ...PublishOption) (*AsyncResult, error) {
 	task, ok := p.registredTasks[taskName]
 	if !ok {
-		return errors.New("missing task")
+		return nil, errors.New("missing task")
 	}
 	body, err := tpublisher.ToPublish()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	cbMessage := newCabbageMessage(taskName, body)
-	if err := p.broker.SendCabbageMessage(task.QueueName, cbMessage); err != nil {
+	options := newPublishOptions(opts)
+	options.apply(cbMessage)
+	key, ttl := uniqueKey(task, body, options)
+	if ttl > 0 {
+		if err := p.acquireUnique(key, ttl, cbMessage); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.publish(task.QueueName, cbMessage); err != nil {
+		if ttl > 0 {
+			p.releaseUnique(key, cbMessage)
+		}
+		return nil, err
+	}
+	return newAsyncResult(cbMessage.ID, p.resultBackend), nil
+}
+
+// publish send message through publish interceptors, failure result is stored if message is not sent
+func (p *Publisher) publish(queueName string, cbMessage *CabbageMessage) error {
+	p.taskLock.RLock()
+	send := chainPublishInterceptors(p.send, p.interceptors)
+	p.taskLock.RUnlock()
+	if err := send(queueName, cbMessage); err != nil {
+		taskResult := newTaskResult(cbMessage, TaskStateFailure)
+		taskResult.Error = err.Error()
+		p.setTaskResult(taskResult)
 		return err
 	}
 	return nil
 }
 
+// send store pending task result and send message to broker
+func (p *Publisher) send(queueName string, cbMessage *CabbageMessage) error {
+	p.taskLock.RLock()
+	compression, security := p.compression, p.security
+	p.taskLock.RUnlock()
+	if err := validateHeaders(cbMessage.Headers); err != nil {
+		return err
+	}
+	// body is compressed before encryption, encrypted message is signed
+	if err := compression.compress(cbMessage); err != nil {
+		return err
+	}
+	if err := security.seal(cbMessage); err != nil {
+		return err
+	}
+	// pending result is stored before sending, so it does not overwrite result of fast worker
+	p.setTaskResult(newTaskResult(cbMessage, TaskStatePending))
+	return p.broker.SendCabbageMessage(queueName, cbMessage)
+}
+
+// Use add interceptors, which wrap publishing of every task message
+func (p *Publisher) Use(interceptors ...PublishInterceptor) {
+	p.taskLock.Lock()
+	p.interceptors = append(p.interceptors, interceptors...)
+	p.taskLock.Unlock()
+}
+
+// setTaskResult store task result in result backend, if it is set
+func (p *Publisher) setTaskResult(taskResult *TaskResult) {
+	if p.resultBackend == nil {
+		return
+	}
+	if err := p.resultBackend.SetTaskResult(taskResult); err != nil {
+		log.Printf("[!] cant store task %s result: %+v", taskResult.ID, err)
+	}
+}
+
+// SetResultBackend set backend for storing task results
+func (p *Publisher) SetResultBackend(backend ResultBackend) {
+	p.resultBackend = backend
+}
+
+// SetGroupBackend set backend for storing groups state
+func (p *Publisher) SetGroupBackend(backend GroupBackend) {
+	p.taskLock.Lock()
+	p.groupBackend = backend
+	p.taskLock.Unlock()
+}
+
+// SetDedupStore set store of unique tasks dedup keys
+func (p *Publisher) SetDedupStore(store DedupStore) {
+	p.taskLock.Lock()
+	p.dedupStore = store
+	p.taskLock.Unlock()
+}
+
+// SetCodec set default codec for typed tasks payloads
+func (p *Publisher) SetCodec(codec Codec) {
+	p.taskLock.Lock()
+	p.codec = codec
+	p.taskLock.Unlock()
+}
+
+// SetCompression enable compression of message bodies, which are not smaller than threshold bytes,
+// nil compressor disables compression
+func (p *Publisher) SetCompression(compressor Compressor, threshold int) {
+	p.taskLock.Lock()
+	p.compression = &compression{compressor: compressor, threshold: threshold}
+	p.taskLock.Unlock()
+}
+
+// SetSecurity set message signing and encryption settings, nil disables signing and encryption
+func (p *Publisher) SetSecurity(security *SecurityConfig) {
+	p.taskLock.Lock()
+	p.security = security
+	p.taskLock.Unlock()
+}
+
+// taskCodec returns task codec, if it is set, otherwise publisher codec or JSONCodec
+func (p *Publisher) taskCodec(taskName string) Codec {
+	p.taskLock.RLock()
+	defer p.taskLock.RUnlock()
+	if task, ok := p.registredTasks[taskName]; ok && task.Codec != nil {
+		return task.Codec
+	}
+	if p.codec != nil {
+		return p.codec
+	}
+	return JSONCodec{}
+}
+
+// AsyncResult returns AsyncResult for task ID
+func (p *Publisher) AsyncResult(ID string) *AsyncResult {
+	return newAsyncResult(ID, p.resultBackend)
+}
+
 // RegisterTask register task in publisher
 func (p *Publisher) RegisterTask(task *Task) {
 	p.taskLock.Lock()
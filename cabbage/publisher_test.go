@@ -0,0 +1,74 @@
+package cabbage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// newTestPublisher create publisher with registered test task
+func newTestPublisher(broker CabbageBroker) *Publisher {
+	publisher := newPublisher(broker)
+	publisher.RegisterTask(&Task{Name: taskName, QueueName: queueName, WithPublish: true})
+	return publisher
+}
+
+func TestPublishCountdown(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	publisher := newTestPublisher(broker)
+	if _, err := publisher.PublishTask(taskName, &testSchData{ID: "delayed"}, Countdown(200*time.Millisecond)); err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	if _, err := broker.GetCabbageMessage(queueName); err != ErrQueueEmpty {
+		t.Fatalf("delayed message must not be delivered before ETA, %v", err)
+	}
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	msg, err := broker.GetCabbageMessageWithContext(ctx, queueName)
+	if err != nil {
+		t.Fatalf("cant get delayed message, %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("delayed message delivered too early, after %s", elapsed)
+	}
+	if msg.ETA == nil {
+		t.Error("delayed message must have ETA")
+	}
+}
+
+func TestPublishETAOrder(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	publisher := newTestPublisher(broker)
+	now := time.Now()
+	publisher.PublishTask(taskName, &testSchData{ID: "2"}, ETA(now.Add(100*time.Millisecond)))
+	publisher.PublishTask(taskName, &testSchData{ID: "1"}, ETA(now.Add(50*time.Millisecond)))
+	publisher.PublishTask(taskName, &testSchData{ID: "0"}, ETA(now.Add(-time.Second)))
+	time.Sleep(150 * time.Millisecond)
+	for _, expected := range []string{"0", "1", "2"} {
+		msg, err := broker.GetCabbageMessage(queueName)
+		if err != nil {
+			t.Fatalf("cant get message, %v", err)
+		}
+		if string(msg.Body) != `{"id":"`+expected+`","site_id":""}` {
+			t.Errorf("invalid order, expected %s, got %s", expected, msg.Body)
+		}
+	}
+}
+
+func TestPublishReservedHeader(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	publisher := newTestPublisher(broker)
+	for _, key := range []string{"x-cabbage-dead-letter-reason", "x-death", "x-first-death-queue"} {
+		if _, err := publisher.PublishTask(taskName, &testSchData{}, Header(key, "spoofed")); !errors.Is(err, ErrReservedHeader) {
+			t.Errorf("message with reserved header %s must not be published, got %v", key, err)
+		}
+	}
+	if _, err := publisher.PublishTask(taskName, &testSchData{}, Headers(map[string]string{"id": "42", "taskName": "other"})); err != nil {
+		t.Errorf("message with headers named as message fields must be published, got %v", err)
+	}
+}
@@ -1,8 +1,13 @@
 package cabbage
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/streadway/amqp"
 )
@@ -11,10 +16,37 @@ type ConsumingChannels map[string]<-chan amqp.Delivery
 
 // RabbitMQBroker implement rabbtimq broker
 type RabbitMQBroker struct {
-	connection        *amqp.Connection
-	channel           *amqp.Channel
-	consumingChannels ConsumingChannels
-	rate              int
+	connection         *amqp.Connection
+	channel            *amqp.Channel
+	consumingChannels  ConsumingChannels
+	rate               int
+	celery             bool                // celery protocol v2 exchanges, queues and messages
+	deadLetterExchange bool                // queues are declared with dead letter exchange arguments
+	declaredQueues     map[string]struct{} // queues declared on broker connection
+	declaredLock       sync.Mutex
+}
+
+// RabbitMQBrokerOption configures RabbitMQBroker
+type RabbitMQBrokerOption func(b *RabbitMQBroker)
+
+// WithRabbitMQCeleryProtocol enables celery protocol v2 compatible messages: queue is bound to direct exchange
+// with queue name, message body is json [args, kwargs, embed] with celery headers, so Python celery workers
+// can proccess tasks published by go and go workers can proccess tasks published by Python.
+// Queues are declared without dead letter exchange, same as celery declares them, so dead letters are sent explicitly
+func WithRabbitMQCeleryProtocol() RabbitMQBrokerOption {
+	return func(b *RabbitMQBroker) {
+		b.celery = true
+	}
+}
+
+// WithRabbitMQDeadLetterExchange declares queues with x-dead-letter-exchange argument, so rejected messages are
+// dead lettered by rabbitmq itself. RabbitMQ does not allow to change arguments of existing queue, so queues declared
+// without argument must be deleted before enabling it. By default queues are declared without arguments and dead
+// letters are sent to dead letter queue explicitly. Cant be used with celery protocol
+func WithRabbitMQDeadLetterExchange() RabbitMQBrokerOption {
+	return func(b *RabbitMQBroker) {
+		b.deadLetterExchange = true
+	}
 }
 
 // RabbitMQQueue queue for rabbitmq
@@ -22,6 +54,7 @@ type RabbitMQQueue struct {
 	Name       string
 	Durable    bool
 	AutoDelete bool
+	Args       amqp.Table
 }
 
 // newRabbitMQQueue construct RabbitMQQueue
@@ -33,8 +66,13 @@ func newRabbitMQQueue(name string) *RabbitMQQueue {
 	}
 }
 
+// celeryProtocol checks that broker uses celery protocol
+func (b *RabbitMQBroker) celeryProtocol() bool {
+	return b.celery
+}
+
 // NewRabbitMQBroker constructor for RabbitmqBroker
-func NewRabbitMQBroker(url string, rate int) (*RabbitMQBroker, error) {
+func NewRabbitMQBroker(url string, rate int, opts ...RabbitMQBrokerOption) (*RabbitMQBroker, error) {
 	conn, err := amqp.Dial(url)
 	if err != nil {
 		return nil, fmt.Errorf("RQ.Connection %w", err)
@@ -48,6 +86,14 @@ func NewRabbitMQBroker(url string, rate int) (*RabbitMQBroker, error) {
 		channel:           ch,
 		rate:              rate,
 		consumingChannels: make(map[string]<-chan amqp.Delivery),
+		declaredQueues:    make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(broker)
+	}
+	if broker.celery && broker.deadLetterExchange {
+		conn.Close()
+		return nil, errors.New("celery protocol cant be used with dead letter exchange")
 	}
 	if err := broker.channel.Qos(broker.rate, 0, false); err != nil {
 		log.Println("Cant Qos RQ channel")
@@ -56,20 +102,86 @@ func NewRabbitMQBroker(url string, rate int) (*RabbitMQBroker, error) {
 	return broker, nil
 }
 
-// createExchangeName generate exchange name
+// createExchangeName generate exchange name, celery exchange is named same as queue
 func (b *RabbitMQBroker) createExchangeName(queueName string) string {
+	if b.celery {
+		return queueName
+	}
 	return fmt.Sprintf("%s_cabbage_exchange", queueName)
 }
 
-// createQueue declares RabbitMQQueue with stored configuration
+// createDeadLetterExchangeName generate dead letter exchange name
+func (b *RabbitMQBroker) createDeadLetterExchangeName(queueName string) string {
+	return fmt.Sprintf("%s_cabbage_dead_letter_exchange", queueName)
+}
+
+// createDeadLetterQueue declares dead letter exchange and queue for queue
+func (b *RabbitMQBroker) createDeadLetterQueue(queueName string) error {
+	q := newRabbitMQQueue(deadLetterQueueName(queueName))
+	exchangeName := b.createDeadLetterExchangeName(queueName)
+	err := b.channel.ExchangeDeclare(
+		exchangeName,
+		"direct",
+		true,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = b.channel.QueueDeclare(
+		q.Name,
+		q.Durable,
+		q.AutoDelete,
+		false,
+		false,
+		q.Args,
+	)
+	if err != nil {
+		return err
+	}
+	return b.channel.QueueBind(q.Name, queueName, exchangeName, false, nil)
+}
+
+// createQueue declares RabbitMQQueue with stored configuration, with dead letter exchange option rejected messages
+// are routed to dead letter queue by rabbitmq. Queue is declared once per broker connection
 func (b *RabbitMQBroker) createQueue(queueName string) error {
+	b.declaredLock.Lock()
+	_, declared := b.declaredQueues[queueName]
+	b.declaredLock.Unlock()
+	if declared {
+		return nil
+	}
+	if err := b.declareQueue(queueName); err != nil {
+		return err
+	}
+	b.declaredLock.Lock()
+	b.declaredQueues[queueName] = struct{}{}
+	b.declaredLock.Unlock()
+	return nil
+}
+
+// declareQueue declares queue, its exchange and dead letter queue
+func (b *RabbitMQBroker) declareQueue(queueName string) error {
+	if err := b.createDeadLetterQueue(queueName); err != nil {
+		return err
+	}
 	q := newRabbitMQQueue(queueName)
+	// queues are declared without arguments by default, so queues declared by previous versions and celery match
+	if b.deadLetterExchange {
+		q.Args = amqp.Table{
+			"x-dead-letter-exchange":    b.createDeadLetterExchangeName(queueName),
+			"x-dead-letter-routing-key": queueName,
+		}
+	}
 	exchangeName := b.createExchangeName(queueName)
 	err := b.channel.ExchangeDeclare(
 		exchangeName,
 		"direct",
 		true,
-		true,
+		!b.celery,
 		false,
 		false,
 		nil,
@@ -83,7 +195,7 @@ func (b *RabbitMQBroker) createQueue(queueName string) error {
 		q.AutoDelete,
 		false,
 		false,
-		nil,
+		q.Args,
 	)
 	if err != nil {
 		return err
@@ -92,6 +204,32 @@ func (b *RabbitMQBroker) createQueue(queueName string) error {
 	return err
 }
 
+// createDelayQueueName generate delay queue name
+func (b *RabbitMQBroker) createDelayQueueName(queueName string, delay time.Duration) string {
+	return fmt.Sprintf("%s_cabbage_delay_%ds", queueName, delay/time.Second)
+}
+
+// createDelayQueue declares queue without consumers, where messages wait delay and then are dead lettered to queue.
+// Delay queue is deleted after minute without publishing
+func (b *RabbitMQBroker) createDelayQueue(queueName string, delay time.Duration) (string, error) {
+	q := newRabbitMQQueue(b.createDelayQueueName(queueName, delay))
+	q.Args = amqp.Table{
+		"x-message-ttl":             int64(delay / time.Millisecond),
+		"x-expires":                 int64((delay + time.Minute) / time.Millisecond),
+		"x-dead-letter-exchange":    b.createExchangeName(queueName),
+		"x-dead-letter-routing-key": queueName,
+	}
+	_, err := b.channel.QueueDeclare(
+		q.Name,
+		q.Durable,
+		q.AutoDelete,
+		false,
+		false,
+		q.Args,
+	)
+	return q.Name, err
+}
+
 // Close close broker connections
 func (b *RabbitMQBroker) Close() {
 	b.connection.Close()
@@ -121,25 +259,136 @@ func (b *RabbitMQBroker) startConsumingChannel(queueName string) error {
 
 // GetCabbageMessage get cabbage message from broker
 func (b *RabbitMQBroker) GetCabbageMessage(queueName string) (*CabbageMessage, error) {
-	select {
-	case delivery := <-b.consumingChannels[queueName]:
-		deliveryAck(delivery)
-		messageId := delivery.MessageId
-		if messageId == "" {
-			messageId = "<EMPTY>"
+	for {
+		select {
+		case delivery, ok := <-b.consumingChannels[queueName]:
+			cbMessage, err := b.receivedCabbageMessage(queueName, delivery, ok)
+			if cbMessage == nil && err == nil {
+				continue
+			}
+			return cbMessage, err
+		default:
+			return nil, fmt.Errorf("consuming channel is empty")
+		}
+	}
+}
+
+// GetCabbageMessageWithContext get cabbage message from broker, waits for delivery until context is done
+func (b *RabbitMQBroker) GetCabbageMessageWithContext(ctx context.Context, queueName string) (*CabbageMessage, error) {
+	for {
+		select {
+		case delivery, ok := <-b.consumingChannels[queueName]:
+			cbMessage, err := b.receivedCabbageMessage(queueName, delivery, ok)
+			if cbMessage == nil && err == nil {
+				continue
+			}
+			return cbMessage, err
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		}
-		cMessage := CabbageMessage{
-			ID:        delivery.Headers["id"].(string),
-			Body:      delivery.Body,
-			MessageId: messageId,
-			Timestamp: delivery.Timestamp,
-			TaskName:  delivery.Headers["taskName"].(string),
+	}
+}
+
+// receivedCabbageMessage convert consumed delivery to cabbage message,
+// returns nil message without error if celery message with future ETA is moved to delay queue
+func (b *RabbitMQBroker) receivedCabbageMessage(queueName string, delivery amqp.Delivery, ok bool) (*CabbageMessage, error) {
+	if !ok {
+		return nil, fmt.Errorf("consuming channel for queue %s is closed", queueName)
+	}
+	if !b.celery {
+		cbMessage := deliveryToCabbageMessage(delivery)
+		cbMessage.receipt = delivery
+		return cbMessage, nil
+	}
+	cbMessage, err := celeryDeliveryToCabbageMessage(delivery)
+	if err != nil {
+		// message cant be decoded, so it cant be proccessed by any go consumer
+		if dlErr := b.sendMalformedDeadLetter(queueName, delivery, err); dlErr != nil {
+			return nil, dlErr
 		}
+		return nil, err
+	}
+	if now := time.Now(); cbMessage.isDelayed(now) {
+		if err := b.sendDelayed(queueName, cbMessage, now); err != nil {
+			return nil, err
+		}
+		return nil, deliveryAck(delivery)
+	}
+	cbMessage.receipt = delivery
+	return cbMessage, nil
+}
 
-		return &cMessage, nil
-	default:
-		return nil, fmt.Errorf("consuming channel is empty")
+// sendMalformedDeadLetter send delivery, which cant be decoded, to dead letter queue and acknowledges it
+func (b *RabbitMQBroker) sendMalformedDeadLetter(queueName string, delivery amqp.Delivery, err error) error {
+	headers := amqp.Table{}
+	for key, value := range delivery.Headers {
+		headers[key] = value
 	}
+	headers["x-cabbage-dead-letter-reason"] = DeadLetterReasonMalformed
+	headers["x-cabbage-dead-letter-error"] = err.Error()
+	headers["x-cabbage-dead-letter-timestamp"] = time.Now()
+	publishing := amqp.Publishing{
+		DeliveryMode:    amqp.Persistent,
+		Headers:         headers,
+		ContentType:     delivery.ContentType,
+		ContentEncoding: delivery.ContentEncoding,
+		Body:            delivery.Body,
+		Timestamp:       delivery.Timestamp,
+	}
+	if err := b.channel.Publish(b.createDeadLetterExchangeName(queueName), queueName, false, false, publishing); err != nil {
+		return err
+	}
+	return deliveryAck(delivery)
+}
+
+// receivedDelivery get amqp delivery of received cabbage message
+func receivedDelivery(cbMessage *CabbageMessage) (amqp.Delivery, error) {
+	delivery, ok := cbMessage.receipt.(amqp.Delivery)
+	if !ok {
+		return delivery, fmt.Errorf("message %s was not received from rabbitmq", cbMessage.ID)
+	}
+	return delivery, nil
+}
+
+// AckCabbageMessage acknowledges received message
+func (b *RabbitMQBroker) AckCabbageMessage(queueName string, cbMessage *CabbageMessage) error {
+	delivery, err := receivedDelivery(cbMessage)
+	if err != nil {
+		return err
+	}
+	return deliveryAck(delivery)
+}
+
+// NackCabbageMessage negatively acknowledges received message, message without requeue is routed to dead letter queue
+func (b *RabbitMQBroker) NackCabbageMessage(queueName string, cbMessage *CabbageMessage, requeue bool) error {
+	delivery, err := receivedDelivery(cbMessage)
+	if err != nil {
+		return err
+	}
+	if !b.deadLetterExchange && !requeue {
+		return b.deadLetterDelivery(queueName, cbMessage, delivery)
+	}
+	return delivery.Nack(false, requeue)
+}
+
+// RejectCabbageMessage rejects received message, message without requeue is routed to dead letter queue
+func (b *RabbitMQBroker) RejectCabbageMessage(queueName string, cbMessage *CabbageMessage, requeue bool) error {
+	delivery, err := receivedDelivery(cbMessage)
+	if err != nil {
+		return err
+	}
+	if !b.deadLetterExchange && !requeue {
+		return b.deadLetterDelivery(queueName, cbMessage, delivery)
+	}
+	return delivery.Reject(requeue)
+}
+
+// deadLetterDelivery send rejected message to dead letter queue, when queue has no dead letter exchange
+func (b *RabbitMQBroker) deadLetterDelivery(queueName string, cbMessage *CabbageMessage, delivery amqp.Delivery) error {
+	if err := b.SendDeadLetter(queueName, newDeadLetterMessage(cbMessage, DeadLetterReasonRejected, nil)); err != nil {
+		return err
+	}
+	return deliveryAck(delivery)
 }
 
 // SendCabbageMessage send cabbage message to broker
@@ -147,24 +396,293 @@ func (b *RabbitMQBroker) SendCabbageMessage(queueName string, cbMessage *Cabbage
 	if err := b.createQueue(queueName); err != nil {
 		return err
 	}
-	publishMessage := amqp.Publishing{
-		DeliveryMode: amqp.Persistent,
-		Headers:      amqp.Table{"id": cbMessage.ID, "taskName": cbMessage.TaskName},
-		ContentType:  "application/json",
-		Body:         cbMessage.Body,
-		Timestamp:    cbMessage.Timestamp,
+	// celery workers wait for ETA themselves, so celery messages are published to queue at once
+	if now := time.Now(); cbMessage.isDelayed(now) && !b.celery {
+		return b.sendDelayed(queueName, cbMessage, now)
+	}
+	publishing, err := b.publishing(cbMessage)
+	if err != nil {
+		return err
 	}
 	return b.channel.Publish(
 		b.createExchangeName(queueName),
 		queueName,
 		false,
 		false,
-		publishMessage,
+		publishing,
+	)
+}
+
+// sendDelayed publish message to delay queue, message is dead lettered to queue after ETA
+func (b *RabbitMQBroker) sendDelayed(queueName string, cbMessage *CabbageMessage, now time.Time) error {
+	// delay is rounded up to seconds to limit delay queues count
+	delay := cbMessage.ETA.Sub(now)
+	delay = (delay + time.Second - 1) / time.Second * time.Second
+	delayQueueName, err := b.createDelayQueue(queueName, delay)
+	if err != nil {
+		return err
+	}
+	publishing, err := b.publishing(cbMessage)
+	if err != nil {
+		return err
+	}
+	return b.channel.Publish("", delayQueueName, false, false, publishing)
+}
+
+// publishing convert cabbage message to amqp publishing of broker protocol
+func (b *RabbitMQBroker) publishing(cbMessage *CabbageMessage) (amqp.Publishing, error) {
+	if b.celery {
+		return cabbageMessageToCeleryPublishing(cbMessage)
+	}
+	return cabbageMessageToPublishing(cbMessage), nil
+}
+
+// SendDeadLetter send cabbage message to queue dead letter queue
+func (b *RabbitMQBroker) SendDeadLetter(queueName string, cbMessage *CabbageMessage) error {
+	if err := b.createQueue(queueName); err != nil {
+		return err
+	}
+	return b.channel.Publish(
+		b.createDeadLetterExchangeName(queueName),
+		queueName,
+		false,
+		false,
+		cabbageMessageToPublishing(cbMessage),
 	)
 }
 
+// GetDeadLetters returns up to limit messages from queue dead letter queue, messages are returned back to dead letter queue
+func (b *RabbitMQBroker) GetDeadLetters(queueName string, limit int) ([]*CabbageMessage, error) {
+	if err := b.createQueue(queueName); err != nil {
+		return nil, err
+	}
+	var deliveries []amqp.Delivery
+	defer func() {
+		for _, delivery := range deliveries {
+			if err := delivery.Nack(false, true); err != nil {
+				log.Printf("rabbitmq_broker: failed to return dead letter message %+v: %+v", delivery.MessageId, err)
+			}
+		}
+	}()
+	var messages []*CabbageMessage
+	for limit <= 0 || len(messages) < limit {
+		delivery, ok, err := b.channel.Get(deadLetterQueueName(queueName), false)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		deliveries = append(deliveries, delivery)
+		messages = append(messages, deliveryToCabbageMessage(delivery))
+	}
+	return messages, nil
+}
+
+// RequeueDeadLetters move all messages from dead letter queue back to queue
+func (b *RabbitMQBroker) RequeueDeadLetters(queueName string) (int, error) {
+	if err := b.createQueue(queueName); err != nil {
+		return 0, err
+	}
+	count := 0
+	for {
+		delivery, ok, err := b.channel.Get(deadLetterQueueName(queueName), false)
+		if err != nil {
+			return count, err
+		}
+		if !ok {
+			return count, nil
+		}
+		cbMessage := newRequeuedMessage(deliveryToCabbageMessage(delivery))
+		if err := b.SendCabbageMessage(queueName, cbMessage); err != nil {
+			delivery.Nack(false, true)
+			return count, err
+		}
+		deliveryAck(delivery)
+		count++
+	}
+}
+
+// PurgeDeadLetters remove all messages from queue dead letter queue
+func (b *RabbitMQBroker) PurgeDeadLetters(queueName string) (int, error) {
+	if err := b.createQueue(queueName); err != nil {
+		return 0, err
+	}
+	return b.channel.QueuePurge(deadLetterQueueName(queueName), false)
+}
+
+// cabbageMessageToPublishing convert cabbage message to amqp publishing
+func cabbageMessageToPublishing(cbMessage *CabbageMessage) amqp.Publishing {
+	headers := amqp.Table{}
+	for key, value := range cbMessage.Headers {
+		if !isReservedHeader(key) {
+			headers[key] = value
+		}
+	}
+	headers[rabbitMQIDHeader] = cbMessage.ID
+	headers[rabbitMQTaskNameHeader] = cbMessage.TaskName
+	headers[rabbitMQRetriesHeader] = int32(cbMessage.Retries)
+	if dl := cbMessage.DeadLetter; dl != nil {
+		headers["x-cabbage-dead-letter-reason"] = dl.Reason
+		headers["x-cabbage-dead-letter-error"] = dl.Error
+		headers["x-cabbage-dead-letter-attempts"] = int32(dl.Attempts)
+		headers["x-cabbage-dead-letter-timestamp"] = dl.Timestamp
+	}
+	if cbMessage.ETA != nil {
+		headers[rabbitMQETAHeader] = cbMessage.ETA.Format(time.RFC3339Nano)
+	}
+	if cbMessage.Timeout > 0 {
+		headers[rabbitMQTimeoutHeader] = int64(cbMessage.Timeout / time.Millisecond)
+	}
+	if len(cbMessage.Chain) > 0 {
+		chain, _ := json.Marshal(cbMessage.Chain)
+		headers["x-cabbage-chain"] = string(chain)
+	}
+	if cbMessage.Group != nil {
+		group, _ := json.Marshal(cbMessage.Group)
+		headers["x-cabbage-group"] = string(group)
+	}
+	contentType := cbMessage.ContentType
+	if contentType == "" {
+		contentType = ContentTypeJSON
+	}
+	return amqp.Publishing{
+		DeliveryMode:    amqp.Persistent,
+		Headers:         headers,
+		ContentType:     contentType,
+		ContentEncoding: cbMessage.ContentEncoding,
+		Body:            cbMessage.Body,
+		Timestamp:       cbMessage.Timestamp,
+	}
+}
+
+// deliveryToCabbageMessage convert amqp delivery to cabbage message
+func deliveryToCabbageMessage(delivery amqp.Delivery) *CabbageMessage {
+	messageId := delivery.MessageId
+	if messageId == "" {
+		messageId = "<EMPTY>"
+	}
+	headers := delivery.Headers
+	if _, ok := headers[rabbitMQIDHeader]; !ok {
+		headers = renameLegacyHeaders(headers)
+	}
+	cbMessage := &CabbageMessage{
+		ID:              headerString(headers, rabbitMQIDHeader),
+		Body:            delivery.Body,
+		MessageId:       messageId,
+		Timestamp:       delivery.Timestamp,
+		TaskName:        headerString(headers, rabbitMQTaskNameHeader),
+		Retries:         headerInt(headers, rabbitMQRetriesHeader),
+		Timeout:         time.Duration(headerInt(headers, rabbitMQTimeoutHeader)) * time.Millisecond,
+		ContentType:     delivery.ContentType,
+		ContentEncoding: delivery.ContentEncoding,
+	}
+	if eta, err := time.Parse(time.RFC3339Nano, headerString(headers, rabbitMQETAHeader)); err == nil {
+		cbMessage.ETA = &eta
+	}
+	if chain := headerString(headers, "x-cabbage-chain"); chain != "" {
+		if err := json.Unmarshal([]byte(chain), &cbMessage.Chain); err != nil {
+			log.Printf("rabbitmq_broker: invalid chain of message %s: %+v", cbMessage.ID, err)
+		}
+	}
+	if group := headerString(headers, "x-cabbage-group"); group != "" {
+		if err := json.Unmarshal([]byte(group), &cbMessage.Group); err != nil {
+			log.Printf("rabbitmq_broker: invalid group of message %s: %+v", cbMessage.ID, err)
+		}
+	}
+	for key, value := range headers {
+		if value, ok := value.(string); ok && !isReservedHeader(key) {
+			if cbMessage.Headers == nil {
+				cbMessage.Headers = make(map[string]string)
+			}
+			cbMessage.Headers[key] = value
+		}
+	}
+	if reason := headerString(headers, "x-cabbage-dead-letter-reason"); reason != "" {
+		timestamp, _ := headers["x-cabbage-dead-letter-timestamp"].(time.Time)
+		cbMessage.DeadLetter = &DeadLetter{
+			Reason:    reason,
+			Error:     headerString(headers, "x-cabbage-dead-letter-error"),
+			Attempts:  headerInt(headers, "x-cabbage-dead-letter-attempts"),
+			Timestamp: timestamp,
+		}
+	} else if death := lastDeath(delivery); death != nil && headerString(death, "queue") == delivery.RoutingKey {
+		// message dead lettered by rabbitmq itself from queue, delayed messages are dead lettered from delay queues
+		timestamp, _ := death["time"].(time.Time)
+		cbMessage.DeadLetter = &DeadLetter{
+			Reason:    headerString(death, "reason"),
+			Attempts:  cbMessage.Retries + 1,
+			Timestamp: timestamp,
+		}
+	}
+	return cbMessage
+}
+
+// cabbageMessageToCeleryPublishing convert cabbage message to celery protocol v2 amqp publishing
+func cabbageMessageToCeleryPublishing(cbMessage *CabbageMessage) (amqp.Publishing, error) {
+	body, err := celeryBody(cbMessage)
+	if err != nil {
+		return amqp.Publishing{}, err
+	}
+	return amqp.Publishing{
+		DeliveryMode:    amqp.Persistent,
+		Headers:         amqp.Table(celeryHeaders(cbMessage, body)),
+		ContentType:     ContentTypeJSON,
+		ContentEncoding: celeryContentEncoding,
+		CorrelationId:   cbMessage.ID,
+		MessageId:       cbMessage.MessageId,
+		Body:            body,
+	}, nil
+}
+
+// celeryDeliveryToCabbageMessage convert celery protocol v2 amqp delivery to cabbage message
+func celeryDeliveryToCabbageMessage(delivery amqp.Delivery) (*CabbageMessage, error) {
+	if delivery.ContentType != ContentTypeJSON {
+		return nil, fmt.Errorf("unsupported celery content type %s", delivery.ContentType)
+	}
+	cbMessage, err := celeryHeadersToCabbageMessage(delivery.Headers, delivery.Body)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.MessageId != "" {
+		cbMessage.MessageId = delivery.MessageId
+	}
+	return cbMessage, nil
+}
+
+// amqp headers of cabbage message fields
+const (
+	rabbitMQIDHeader       = "x-cabbage-id"
+	rabbitMQTaskNameHeader = "x-cabbage-task-name"
+	rabbitMQRetriesHeader  = "x-cabbage-retries"
+	rabbitMQETAHeader      = "x-cabbage-eta"
+	rabbitMQTimeoutHeader  = "x-cabbage-timeout"
+)
+
+// rabbitMQLegacyHeaders amqp headers of message fields in messages published by previous versions
+var rabbitMQLegacyHeaders = map[string]string{
+	"id":       rabbitMQIDHeader,
+	"taskName": rabbitMQTaskNameHeader,
+	"retries":  rabbitMQRetriesHeader,
+	"eta":      rabbitMQETAHeader,
+	"timeout":  rabbitMQTimeoutHeader,
+}
+
+// renameLegacyHeaders rename message fields headers of message published by previous version,
+// so they are not received as message headers
+func renameLegacyHeaders(headers amqp.Table) amqp.Table {
+	renamed := make(amqp.Table, len(headers))
+	for key, value := range headers {
+		if field, ok := rabbitMQLegacyHeaders[key]; ok {
+			key = field
+		}
+		renamed[key] = value
+	}
+	return renamed
+}
+
 // deliveryAck acknowledges delivery message with retries on error
-func deliveryAck(delivery amqp.Delivery) {
+func deliveryAck(delivery amqp.Delivery) error {
 	var err error
 	for retryCount := 3; retryCount > 0; retryCount-- {
 		if err = delivery.Ack(false); err == nil {
@@ -174,4 +692,39 @@ func deliveryAck(delivery amqp.Delivery) {
 	if err != nil {
 		log.Printf("rabbitmq_broker: failed to acknowledge result message %+v: %+v", delivery.MessageId, err)
 	}
+	return err
+}
+
+// lastDeath returns last x-death entry of message dead lettered by rabbitmq
+func lastDeath(delivery amqp.Delivery) amqp.Table {
+	deaths, ok := delivery.Headers["x-death"].([]interface{})
+	if !ok || len(deaths) == 0 {
+		return nil
+	}
+	death, _ := deaths[0].(amqp.Table)
+	return death
+}
+
+// headerString get string header value, returns empty string if header is missing
+func headerString(headers amqp.Table, key string) string {
+	v, _ := headers[key].(string)
+	return v
+}
+
+// headerInt get integer header value, returns 0 if header is missing
+func headerInt(headers amqp.Table, key string) int {
+	switch v := headers[key].(type) {
+	case int8:
+		return int(v)
+	case int16:
+		return int(v)
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
 }
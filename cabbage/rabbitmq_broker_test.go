@@ -1,8 +1,11 @@
 package cabbage
 
 import (
+	"context"
 	"testing"
 	"time"
+
+	"github.com/streadway/amqp"
 )
 
 func TestMesssageSendAndConsumeFromRabbitMQ(t *testing.T) {
@@ -16,11 +19,18 @@ func TestMesssageSendAndConsumeFromRabbitMQ(t *testing.T) {
 	if err != nil {
 		t.Fatalf("cant send cb message to rabbitmq, %v", err)
 	}
+	// queue is declared once per connection, not on every publish
+	if _, ok := broker.declaredQueues[queueName]; !ok || len(broker.declaredQueues) != 1 {
+		t.Errorf("declared queue must be cached, got %v", broker.declaredQueues)
+	}
 	time.Sleep(100 * time.Millisecond)
 	msg, err := broker.GetCabbageMessage(queueName)
 	if err != nil {
 		t.Fatalf("cant get cb message from rabbitmq, %v", err)
 	}
+	if err := broker.AckCabbageMessage(queueName, msg); err != nil {
+		t.Fatalf("cant ack cb message in rabbitmq, %v", err)
+	}
 	if msg.ID != cbMessage.ID {
 		t.Log("Invalid ids in rabbitmq")
 		t.Fail()
@@ -30,3 +40,160 @@ func TestMesssageSendAndConsumeFromRabbitMQ(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestDeadLettersInRabbitMQ(t *testing.T) {
+	broker := testNewRQBroker(t)
+	defer broker.Close()
+	broker.PurgeDeadLetters(queueName)
+	err := broker.SendDeadLetter(queueName, newDeadLetterMessage(cbMessage, DeadLetterReasonFailed, nil))
+	if err != nil {
+		t.Fatalf("cant send dead letter to rabbitmq, %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	deadLetters, err := broker.GetDeadLetters(queueName, 10)
+	if err != nil || len(deadLetters) != 1 {
+		t.Fatalf("cant get dead letters from rabbitmq, %v", err)
+	}
+	if deadLetters[0].ID != cbMessage.ID || deadLetters[0].DeadLetter.Reason != DeadLetterReasonFailed {
+		t.Log("Invalid dead letter in rabbitmq")
+		t.Fail()
+	}
+	count, err := broker.PurgeDeadLetters(queueName)
+	if err != nil || count != 1 {
+		t.Fatalf("cant purge dead letters in rabbitmq, %d, %v", count, err)
+	}
+}
+
+func TestOrderingInRabbitMQ(t *testing.T) {
+	broker := testNewRQBroker(t)
+	defer broker.Close()
+	fifoQueue := queueName + "_fifo"
+	if err := broker.EnableQueueForWorker(fifoQueue); err != nil {
+		t.Fatalf("cant enable queue, %v", err)
+	}
+	testBrokerOrdering(t, broker, fifoQueue, 5, false)
+}
+
+func TestDelayedMessageInRabbitMQ(t *testing.T) {
+	broker := testNewRQBroker(t)
+	defer broker.Close()
+	delayedQueue := queueName + "_delayed"
+	if err := broker.EnableQueueForWorker(delayedQueue); err != nil {
+		t.Fatalf("cant enable queue, %v", err)
+	}
+	delayed := newCabbageMessage(taskName, body)
+	eta := time.Now().Add(time.Second)
+	delayed.ETA = &eta
+	if err := broker.SendCabbageMessage(delayedQueue, delayed); err != nil {
+		t.Fatalf("cant send delayed cb message to rabbitmq, %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := broker.GetCabbageMessage(delayedQueue); err == nil {
+		t.Fatal("delayed message must not be delivered before ETA")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	msg, err := broker.GetCabbageMessageWithContext(ctx, delayedQueue)
+	if err != nil {
+		t.Fatalf("cant get delayed cb message from rabbitmq, %v", err)
+	}
+	broker.AckCabbageMessage(delayedQueue, msg)
+	if msg.ID != delayed.ID || msg.DeadLetter != nil {
+		t.Log("Invalid delayed message in rabbitmq")
+		t.Fail()
+	}
+}
+
+func TestHeadersInRabbitMQ(t *testing.T) {
+	broker := testNewRQBroker(t)
+	defer broker.Close()
+	if err := broker.EnableQueueForWorker(queueName); err != nil {
+		t.Fatalf("cant enable queue, %v", err)
+	}
+	msg := newCabbageMessage(taskName, body)
+	msg.Headers = map[string]string{"correlation-id": "42", "tenant": "acme"}
+	if err := broker.SendCabbageMessage(queueName, msg); err != nil {
+		t.Fatalf("cant send cb message to rabbitmq, %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	received, err := broker.GetCabbageMessage(queueName)
+	if err != nil {
+		t.Fatalf("cant get cb message from rabbitmq, %v", err)
+	}
+	broker.AckCabbageMessage(queueName, received)
+	if received.Headers["correlation-id"] != "42" || received.Headers["tenant"] != "acme" {
+		t.Errorf("invalid headers in rabbitmq %v", received.Headers)
+	}
+}
+
+func TestRabbitMQHeadersConversion(t *testing.T) {
+	msg := newCabbageMessage(taskName, body)
+	msg.Retries = 2
+	msg.Headers = map[string]string{"tenant": "acme", "id": "spoofed", "x-cabbage-dead-letter-reason": "spoofed"}
+	msg.Chain = []ChainLink{{ID: "next", TaskName: "store", QueueName: queueName}}
+	publishing := cabbageMessageToPublishing(msg)
+	received := deliveryToCabbageMessage(amqp.Delivery{Headers: publishing.Headers, Body: publishing.Body, ContentType: publishing.ContentType})
+	if received.ID != msg.ID || received.Retries != 2 || received.DeadLetter != nil {
+		t.Errorf("message headers must not override reserved headers, got %+v", received)
+	}
+	if len(received.Chain) != 1 || received.Chain[0] != msg.Chain[0] {
+		t.Errorf("invalid chain %+v", received.Chain)
+	}
+	// message fields are sent in x-cabbage- headers, so headers with same names are kept
+	if len(received.Headers) != 2 || received.Headers["tenant"] != "acme" || received.Headers["id"] != "spoofed" {
+		t.Errorf("invalid headers %v", received.Headers)
+	}
+	if received.ContentType != ContentTypeJSON {
+		t.Errorf("message without content type must be sent as json, got %s", received.ContentType)
+	}
+	msg.ContentType = ContentTypeMsgpack
+	msg.ContentEncoding = ContentEncodingZstd
+	if publishing := cabbageMessageToPublishing(msg); publishing.ContentType != ContentTypeMsgpack || publishing.ContentEncoding != ContentEncodingZstd {
+		t.Errorf("invalid content type %s, encoding %s", publishing.ContentType, publishing.ContentEncoding)
+	}
+}
+
+func TestRabbitMQLegacyHeadersConversion(t *testing.T) {
+	// message published by previous version with message fields in headers without x-cabbage- prefix
+	headers := amqp.Table{"id": "legacy", "taskName": taskName, "retries": int32(1), "timeout": int64(1500), "tenant": "acme"}
+	received := deliveryToCabbageMessage(amqp.Delivery{Headers: headers, Body: body})
+	if received.ID != "legacy" || received.TaskName != taskName || received.Retries != 1 || received.Timeout != 1500*time.Millisecond {
+		t.Errorf("invalid legacy message %+v", received)
+	}
+	if len(received.Headers) != 1 || received.Headers["tenant"] != "acme" {
+		t.Errorf("fields headers of legacy message must not be message headers, got %v", received.Headers)
+	}
+}
+
+func TestRabbitMQCeleryConversion(t *testing.T) {
+	msg := newCabbageMessage(taskName, []byte(`[2, 3]`))
+	msg.Headers = map[string]string{"tenant": "acme"}
+	publishing, err := cabbageMessageToCeleryPublishing(msg)
+	if err != nil {
+		t.Fatalf("cant convert message to celery publishing, %v", err)
+	}
+	if err := publishing.Headers.Validate(); err != nil {
+		t.Fatalf("invalid celery amqp headers, %v", err)
+	}
+	if publishing.CorrelationId != msg.ID || publishing.ContentEncoding != "utf-8" || publishing.Headers["task"] != taskName {
+		t.Errorf("invalid celery publishing %+v", publishing)
+	}
+	// celery headers are received from rabbitmq as amqp types
+	publishing.Headers["retries"] = int32(3)
+	publishing.Headers["x-first-death-queue"] = "delayed"
+	received, err := celeryDeliveryToCabbageMessage(amqp.Delivery{
+		Headers:     publishing.Headers,
+		Body:        publishing.Body,
+		ContentType: publishing.ContentType,
+		MessageId:   publishing.MessageId,
+	})
+	if err != nil {
+		t.Fatalf("cant convert celery delivery, %v", err)
+	}
+	if received.ID != msg.ID || received.TaskName != taskName || received.Retries != 3 || string(received.Body) != `[2,3]` {
+		t.Errorf("invalid received message %+v", received)
+	}
+	if len(received.Headers) != 1 || received.Headers["tenant"] != "acme" {
+		t.Errorf("invalid headers %v", received.Headers)
+	}
+}
@@ -0,0 +1,151 @@
+package cabbage
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// RateLimit maximal count of task runs per period
+type RateLimit struct {
+	Count  int
+	Period time.Duration
+}
+
+// rateLimitUnits periods of rate limit units
+var rateLimitUnits = map[string]time.Duration{
+	"s": time.Second, "sec": time.Second, "second": time.Second,
+	"m": time.Minute, "min": time.Minute, "minute": time.Minute,
+	"h": time.Hour, "hour": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour,
+}
+
+// ParseRateLimit parse rate limit like "100/minute", "10/s" or "5/30s"
+func ParseRateLimit(s string) (RateLimit, error) {
+	countPart, unit, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, must be <count>/<period>", s)
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(countPart))
+	if err != nil || count <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q count", s)
+	}
+	unit = strings.ToLower(strings.TrimSpace(unit))
+	period, ok := rateLimitUnits[unit]
+	if !ok {
+		if period, err = time.ParseDuration(unit); err != nil || period <= 0 {
+			return RateLimit{}, fmt.Errorf("invalid rate limit %q period", s)
+		}
+		// redis rate limiter stores buckets with milliseconds precision
+		if period < time.Millisecond {
+			return RateLimit{}, fmt.Errorf("invalid rate limit %q, period must be at least 1ms", s)
+		}
+	}
+	return RateLimit{Count: count, Period: period}, nil
+}
+
+// String returns rate limit as "<count>/<period>"
+func (l RateLimit) String() string {
+	return fmt.Sprintf("%d/%s", l.Count, l.Period)
+}
+
+// RateLimiter is interface for task rate limits token buckets, limiter must be shared by workers for cluster-wide limits
+type RateLimiter interface {
+	// Allow take token from bucket of key, returns zero delay if token is taken,
+	// otherwise delay until token is available
+	Allow(key string, limit RateLimit) (time.Duration, error)
+}
+
+// taskRateLimit returns rate limit of message task, invalid rate limit is logged and task is not limited
+func (w *CabbageWorker) taskRateLimit(cbMessage *CabbageMessage) (RateLimit, bool) {
+	task := w.getTask(cbMessage.TaskName)
+	if task == nil || task.RateLimit == "" {
+		return RateLimit{}, false
+	}
+	limit, err := ParseRateLimit(task.RateLimit)
+	if err != nil {
+		log.Printf("[!] Queue: %s, task %s is not rate limited: %+v", w.queueName, cbMessage.TaskName, err)
+		return RateLimit{}, false
+	}
+	return limit, true
+}
+
+// throttleDelay returns delay of message task, which exceeded its rate limit, local limiter is used
+// if worker has no shared limiter or it failed
+func (w *CabbageWorker) throttleDelay(cbMessage *CabbageMessage) time.Duration {
+	limit, ok := w.taskRateLimit(cbMessage)
+	if !ok {
+		return 0
+	}
+	if w.rateLimiter != nil {
+		delay, err := w.rateLimiter.Allow(cbMessage.TaskName, limit)
+		if err == nil {
+			return delay
+		}
+		log.Printf("[!] Queue: %s, cant check rate limit of task %s, local limiter is used: %+v", w.queueName, cbMessage.TaskName, err)
+	}
+	delay, _ := w.localRateLimiter.Allow(cbMessage.TaskName, limit)
+	return delay
+}
+
+// throttleTask publish message again with ETA after delay, retries of throttled message are not changed
+func (w *CabbageWorker) throttleTask(cbMessage *CabbageMessage, delay time.Duration) {
+	throttled := *cbMessage
+	throttled.MessageId = uuid.NewV4().String()
+	eta := time.Now().Add(delay)
+	throttled.ETA = &eta
+	throttled.receipt = nil
+	w.security.resign(&throttled)
+	log.Printf("[*] Queue: %s, task %s, id %s is rate limited, delayed for %s\n", w.queueName, cbMessage.TaskName, cbMessage.ID, delay)
+	// original message is acknowledged only after delayed message is published
+	if err := w.broker.SendCabbageMessage(w.queueName, &throttled); err != nil {
+		log.Printf("[!] Queue: %s, cant delay rate limited task message %s: %+v", w.queueName, cbMessage.ID, err)
+		w.nackTask(cbMessage)
+		return
+	}
+	w.ackTask(cbMessage)
+}
+
+// tokenBucket token bucket of MemoryRateLimiter
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// MemoryRateLimiter is in-memory RateLimiter, limits are enforced only in one process
+type MemoryRateLimiter struct {
+	lock    sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// NewMemoryRateLimiter create MemoryRateLimiter
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{buckets: make(map[string]*tokenBucket)}
+}
+
+// Allow take token from bucket of key, bucket is refilled with limit count tokens per limit period
+func (l *MemoryRateLimiter) Allow(key string, limit RateLimit) (time.Duration, error) {
+	now := time.Now()
+	capacity := float64(limit.Count)
+	rate := capacity / float64(limit.Period) // tokens per nanosecond
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, updatedAt: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(capacity, bucket.tokens+float64(now.Sub(bucket.updatedAt))*rate)
+	bucket.updatedAt = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0, nil
+	}
+	return time.Duration(math.Ceil((1 - bucket.tokens) / rate)), nil
+}
@@ -0,0 +1,81 @@
+package cabbage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	valid := map[string]RateLimit{
+		"100/minute": {Count: 100, Period: time.Minute},
+		"10/s":       {Count: 10, Period: time.Second},
+		" 5 / Hour ": {Count: 5, Period: time.Hour},
+		"3/30s":      {Count: 3, Period: 30 * time.Second},
+		"1/1ms":      {Count: 1, Period: time.Millisecond},
+	}
+	for s, expected := range valid {
+		if limit, err := ParseRateLimit(s); err != nil || limit != expected {
+			t.Errorf("invalid rate limit of %q: %+v, %v", s, limit, err)
+		}
+	}
+	for _, s := range []string{"", "100", "0/s", "-1/s", "x/s", "10/week", "10/-1s", "5/1ns", "5/999us"} {
+		if _, err := ParseRateLimit(s); err == nil {
+			t.Errorf("rate limit %q must be invalid", s)
+		}
+	}
+}
+
+func TestRegisterTaskInvalidRateLimit(t *testing.T) {
+	client := NewCabbageClient(NewMemoryBroker())
+	defer client.Close()
+	if err := client.RegisterTask(&Task{Name: taskName, QueueName: queueName, RateLimit: "fast"}); err == nil {
+		t.Error("task with invalid rate limit must not be registered")
+	}
+}
+
+func TestWorkerTaskRateLimit(t *testing.T) {
+	service := &flakyTestService{attempts: make(chan int, 10)}
+	client, _ := startTestWorker(t, &Task{Name: taskName, QueueName: queueName, TProccesser: service, RateLimit: "4/second"})
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if _, err := client.publisher.PublishTask(taskName, &testSchData{}); err != nil {
+			t.Fatalf("cant publish task, %v", err)
+		}
+	}
+	for i := 0; i < 6; i++ {
+		select {
+		case attempt := <-service.attempts:
+			if attempt != 1 {
+				t.Errorf("throttled task must not be retried, got attempt %d", attempt)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("only %d of 6 tasks proccessed", i)
+		}
+	}
+	// bucket has 4 tokens, next tokens are available every 250ms
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("tasks must be rate limited, proccessed in %s", elapsed)
+	}
+}
+
+func TestMemoryRateLimiter(t *testing.T) {
+	testRateLimiter(t, NewMemoryRateLimiter())
+}
+
+// testRateLimiter checks that tokens of bucket are taken until bucket is empty
+func testRateLimiter(t *testing.T, limiter RateLimiter) {
+	key := newCabbageMessage(taskName, nil).ID
+	limit := RateLimit{Count: 2, Period: time.Minute}
+	for i := 0; i < 2; i++ {
+		if delay, err := limiter.Allow(key, limit); err != nil || delay != 0 {
+			t.Fatalf("token %d must be taken, got %s, %v", i, delay, err)
+		}
+	}
+	delay, err := limiter.Allow(key, limit)
+	if err != nil || delay <= 0 || delay > 30*time.Second {
+		t.Errorf("empty bucket must return delay until next token, got %s, %v", delay, err)
+	}
+	if delay, err := limiter.Allow(key+"_other", limit); err != nil || delay != 0 {
+		t.Errorf("buckets of keys must be independent, got %s, %v", delay, err)
+	}
+}
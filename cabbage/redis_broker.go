@@ -3,18 +3,174 @@ package cabbage
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/redis/go-redis/v9"
+	uuid "github.com/satori/go.uuid"
+)
+
+// redis scripts for reliable queue, every consumer has processing list and sorted set with visibility deadlines
+// of its received messages
+var (
+	// move message from queue to consumer processing list and store its visibility deadline
+	reliableGetScript = redis.NewScript(`
+local item = redis.call('LMOVE', KEYS[1], KEYS[2], 'LEFT', 'RIGHT')
+if not item then
+	return false
+end
+redis.call('ZADD', KEYS[3], ARGV[1], item)
+return item
+`)
+	// remove message from consumer processing list, push it back to queue head if ARGV[2] is set
+	reliableAckScript = redis.NewScript(`
+redis.call('LREM', KEYS[1], -1, ARGV[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+if ARGV[2] == '1' then
+	redis.call('LPUSH', KEYS[3], ARGV[1])
+end
+return 1
+`)
+	// push messages of consumer with expired visibility deadline back to queue head. Messages received by blocking
+	// BLMOVE get deadline ARGV[2], if consumer crashed before storing it. Consumer without received messages
+	// and with heartbeat before ARGV[4] is removed from consumers set
+	reliableReapScript = redis.NewScript(`
+local items = redis.call('LRANGE', KEYS[1], 0, -1)
+for _, item in ipairs(items) do
+	redis.call('ZADD', KEYS[2], 'NX', ARGV[2], item)
+end
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1], 'LIMIT', 0, 100)
+local count = 0
+for _, item in ipairs(expired) do
+	if redis.call('LREM', KEYS[1], -1, item) > 0 then
+		redis.call('LPUSH', KEYS[3], item)
+		count = count + 1
+	end
+	redis.call('ZREM', KEYS[2], item)
+end
+if redis.call('LLEN', KEYS[1]) == 0 and redis.call('ZCARD', KEYS[2]) == 0 then
+	local heartbeat = redis.call('ZSCORE', KEYS[4], ARGV[3])
+	if heartbeat and tonumber(heartbeat) < tonumber(ARGV[4]) then
+		redis.call('ZREM', KEYS[4], ARGV[3])
+	end
+end
+return count
+`)
+	// push delayed messages with passed ETA to queue, to head if ARGV[2] is set
+	promoteDelayedScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 100)
+for _, item in ipairs(due) do
+	if ARGV[2] == '1' then
+		redis.call('LPUSH', KEYS[2], item)
+	else
+		redis.call('RPUSH', KEYS[2], item)
+	end
+	redis.call('ZREM', KEYS[1], item)
+end
+return #due
+`)
+)
+
+const (
+	// redisBlockTimeout timeout of blocking redis commands, context is checked between blocking calls
+	redisBlockTimeout = time.Second
+	// redisConsumerTTL consumer of reliable queue without heartbeat is removed from consumers set after ttl,
+	// when all its messages are returned to queue
+	redisConsumerTTL = time.Hour
 )
 
 // RedisBroker is cabbage broker for redis
 type RedisBroker struct {
-	client *redis.Client
-	ctx    context.Context
+	client            *redis.Client
+	ctx               context.Context
+	reliable          bool
+	lifo              bool
+	visibilityTimeout time.Duration
+	consumerID        string
+	reapers           map[string]struct{}
+	heartbeats        map[string]time.Time // last heartbeats of consumer in queues consumers sets
+	heartbeatsLock    sync.Mutex
+	reapersLock       sync.Mutex
+	reapersWG         sync.WaitGroup
+	stop              chan struct{}
+	closeOnce         sync.Once
+	codec             Codec // codec of stored messages
+	celery            bool  // celery protocol v2 queue layout
+}
+
+// RedisBrokerOption configures RedisBroker
+type RedisBrokerOption func(b *RedisBroker)
+
+// WithRedisReliableQueue enables reliable queue: received message is moved to consumer processing list
+// and removed only on ack, messages of crashed consumers are returned to queue after visibility timeout
+func WithRedisReliableQueue(visibilityTimeout time.Duration) RedisBrokerOption {
+	return func(b *RedisBroker) {
+		b.reliable = true
+		b.visibilityTimeout = visibilityTimeout
+	}
+}
+
+// WithRedisLIFO enables LIFO mode: newest message is received first.
+// By default redis broker is FIFO queue, same as RabbitMQ broker
+func WithRedisLIFO() RedisBrokerOption {
+	return func(b *RedisBroker) {
+		b.lifo = true
+	}
+}
+
+// WithRedisCodec set codec of messages stored in redis, codec must support encoding of CabbageMessage struct
+// (JSONCodec, MsgpackCodec, GobCodec). Messages stored with json before codec change are still decoded
+func WithRedisCodec(codec Codec) RedisBrokerOption {
+	return func(b *RedisBroker) {
+		b.codec = codec
+	}
+}
+
+// WithRedisCeleryProtocol enables celery protocol v2 compatible queues: messages are stored in kombu json envelope,
+// pushed to list head and received from list tail, so Python celery workers can proccess tasks published by go
+// and go workers can proccess tasks published by Python. Reliable queue and LIFO mode are not supported.
+// Dead letter lists are stored with broker codec
+func WithRedisCeleryProtocol() RedisBrokerOption {
+	return func(b *RedisBroker) {
+		b.celery = true
+	}
+}
+
+// celeryProtocol checks that broker uses celery protocol
+func (b *RedisBroker) celeryProtocol() bool {
+	return b.celery
 }
 
 // NewRedisBroker creates with given redis connection with context
-func NewRedisBrokerWithContext(ctx context.Context, url string) (*RedisBroker, error) {
+func NewRedisBrokerWithContext(ctx context.Context, url string, opts ...RedisBrokerOption) (*RedisBroker, error) {
+	broker := &RedisBroker{
+		ctx:        ctx,
+		consumerID: uuid.NewV4().String(),
+		reapers:    make(map[string]struct{}),
+		heartbeats: make(map[string]time.Time),
+		stop:       make(chan struct{}),
+		codec:      JSONCodec{},
+	}
+	for _, opt := range opts {
+		opt(broker)
+	}
+	if broker.celery && (broker.reliable || broker.lifo) {
+		return nil, errors.New("celery protocol cant be used with reliable queue or LIFO mode")
+	}
+	client, err := newRedisClient(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	broker.client = client
+	return broker, nil
+}
+
+// newRedisClient creates redis client with given redis connection and checks connection
+func newRedisClient(ctx context.Context, url string) (*redis.Client, error) {
 	opts, err := redis.ParseURL(url)
 	if err != nil {
 		return nil, err
@@ -24,46 +180,422 @@ func NewRedisBrokerWithContext(ctx context.Context, url string) (*RedisBroker, e
 	if err != nil {
 		return nil, err
 	}
-	return &RedisBroker{
-		client: client,
-		ctx:    ctx,
-	}, nil
+	return client, nil
 }
 
 // NewRedisBroker creates with given redis connection
-func NewRedisBroker(url string) (*RedisBroker, error) {
+func NewRedisBroker(url string, opts ...RedisBrokerOption) (*RedisBroker, error) {
 	ctx := context.Background()
-	return NewRedisBrokerWithContext(ctx, url)
+	return NewRedisBrokerWithContext(ctx, url, opts...)
+}
+
+// processingListName generate consumer processing list name for queue
+func (b *RedisBroker) processingListName(queueName string, consumerID string) string {
+	return fmt.Sprintf("%s_cabbage_processing_%s", queueName, consumerID)
+}
+
+// inflightSetName generate name of sorted set with visibility deadlines of messages received by consumer
+func (b *RedisBroker) inflightSetName(queueName string, consumerID string) string {
+	return fmt.Sprintf("%s_cabbage_inflight_%s", queueName, consumerID)
+}
+
+// consumersSetName generate name of sorted set with consumers of reliable queue scored by heartbeat
+func (b *RedisBroker) consumersSetName(queueName string) string {
+	return fmt.Sprintf("%s_cabbage_consumers", queueName)
+}
+
+// heartbeat register broker consumer in queue consumers set, so its processing list is reaped after its crash.
+// Heartbeat is stored before first receive and refreshed before consumer ttl
+func (b *RedisBroker) heartbeat(queueName string) error {
+	now := time.Now()
+	b.heartbeatsLock.Lock()
+	last, ok := b.heartbeats[queueName]
+	b.heartbeatsLock.Unlock()
+	if ok && now.Sub(last) < redisConsumerTTL/2 {
+		return nil
+	}
+	z := redis.Z{Score: float64(now.UnixMilli()), Member: b.consumerID}
+	if err := b.client.ZAdd(b.ctx, b.consumersSetName(queueName), z).Err(); err != nil {
+		return err
+	}
+	b.heartbeatsLock.Lock()
+	b.heartbeats[queueName] = now
+	b.heartbeatsLock.Unlock()
+	return nil
+}
+
+// delayedSetName generate name of sorted set with delayed messages scored by ETA
+func (b *RedisBroker) delayedSetName(queueName string) string {
+	return fmt.Sprintf("%s_cabbage_delayed", queueName)
+}
+
+// promoteDelayedMessages push delayed messages with passed ETA to queue
+func (b *RedisBroker) promoteDelayedMessages(queueName string) error {
+	lifo := "0"
+	if b.lifo || b.celery {
+		lifo = "1"
+	}
+	keys := []string{b.delayedSetName(queueName), queueName}
+	return promoteDelayedScript.Run(b.ctx, b.client, keys, time.Now().UnixMilli(), lifo).Err()
 }
 
-// EnableQueueForWorker ...
+// EnableQueueForWorker starts reaper of expired messages for reliable queue
 func (b *RedisBroker) EnableQueueForWorker(queueName string) error {
+	if !b.reliable {
+		return nil
+	}
+	b.reapersLock.Lock()
+	defer b.reapersLock.Unlock()
+	if _, ok := b.reapers[queueName]; ok {
+		return nil
+	}
+	if err := b.heartbeat(queueName); err != nil {
+		return err
+	}
+	b.reapers[queueName] = struct{}{}
+	b.reapersWG.Add(1)
+	go b.reap(queueName)
 	return nil
 }
 
+// reap periodically returns messages with expired visibility timeout back to queue
+func (b *RedisBroker) reap(queueName string) {
+	defer b.reapersWG.Done()
+	interval := b.visibilityTimeout / 2
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-b.ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := b.ReapExpiredMessages(queueName); err != nil {
+				log.Printf("redis_broker: failed to reap expired messages for queue %s: %+v", queueName, err)
+			}
+		}
+	}
+}
+
+// ReapExpiredMessages returns messages of queue consumers with expired visibility timeout back to queue,
+// returns returned messages count
+func (b *RedisBroker) ReapExpiredMessages(queueName string) (int, error) {
+	if err := b.heartbeat(queueName); err != nil {
+		return 0, err
+	}
+	consumers, err := b.client.ZRange(b.ctx, b.consumersSetName(queueName), 0, -1).Result()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	total := 0
+	for _, consumerID := range consumers {
+		keys := []string{
+			b.processingListName(queueName, consumerID),
+			b.inflightSetName(queueName, consumerID),
+			queueName,
+			b.consumersSetName(queueName),
+		}
+		args := []interface{}{now.UnixMilli(), now.Add(b.visibilityTimeout).UnixMilli(), consumerID, now.Add(-redisConsumerTTL).UnixMilli()}
+		count, err := reliableReapScript.Run(b.ctx, b.client, keys, args...).Int()
+		if err != nil {
+			return total, err
+		}
+		total += count
+	}
+	if total > 0 {
+		log.Printf("redis_broker: %d expired messages returned to queue %s", total, queueName)
+	}
+	return total, nil
+}
+
 // Close redis broker
 func (b *RedisBroker) Close() {
-	b.client.Close()
+	b.closeOnce.Do(func() {
+		close(b.stop)
+		b.reapersWG.Wait()
+		b.client.Close()
+	})
 }
 
 // SendCabbageMessage send cabbage message to redis broker
 func (b *RedisBroker) SendCabbageMessage(queueName string, cbMessage *CabbageMessage) error {
-	js, err := json.Marshal(cbMessage)
+	item, err := b.encodeQueueMessage(queueName, cbMessage)
 	if err != nil {
 		return err
 	}
-	err = b.client.LPush(b.ctx, queueName, string(js)).Err()
-	return err
+	// delayed messages are pushed to queue by receivers after ETA,
+	// celery workers wait for ETA themselves, so celery messages are pushed to queue at once
+	if cbMessage.isDelayed(time.Now()) && !b.celery {
+		z := redis.Z{Score: float64(cbMessage.ETA.UnixMilli()), Member: item}
+		return b.client.ZAdd(b.ctx, b.delayedSetName(queueName), z).Err()
+	}
+	// messages are received from list head, celery messages from list tail
+	if b.lifo || b.celery {
+		return b.client.LPush(b.ctx, queueName, item).Err()
+	}
+	return b.client.RPush(b.ctx, queueName, item).Err()
 }
 
 // GetCabbageMessage get cabbage message from redis broker
 func (b *RedisBroker) GetCabbageMessage(queueName string) (*CabbageMessage, error) {
-	item, err := b.client.LPop(b.ctx, queueName).Result()
+	if err := b.promoteDelayedMessages(queueName); err != nil {
+		return nil, err
+	}
+	if b.reliable {
+		return b.getReliableMessage(queueName)
+	}
+	pop := b.client.LPop
+	if b.celery {
+		pop = b.client.RPop
+	}
+	item, err := pop(b.ctx, queueName).Result()
+	if err != nil {
+		return nil, err
+	}
+	return b.receiveQueueMessage(queueName, item)
+}
+
+// GetCabbageMessageWithContext get cabbage message from redis broker, waits for message with BLPOP
+// (BLMOVE for reliable queue) until context is done. Delayed messages are checked between blocking calls
+func (b *RedisBroker) GetCabbageMessageWithContext(ctx context.Context, queueName string) (*CabbageMessage, error) {
+	for {
+		cbMessage, err := b.waitMessage(queueName)
+		if err != redis.Nil {
+			return cbMessage, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// waitMessage waits for message redisBlockTimeout, returns redis.Nil on timeout.
+// Broker context is used for blocking commands, so received message is not lost on worker context cancel
+func (b *RedisBroker) waitMessage(queueName string) (*CabbageMessage, error) {
+	if err := b.promoteDelayedMessages(queueName); err != nil {
+		return nil, err
+	}
+	if b.reliable {
+		return b.waitReliableMessage(queueName)
+	}
+	pop := b.client.BLPop
+	if b.celery {
+		pop = b.client.BRPop
+	}
+	result, err := pop(b.ctx, redisBlockTimeout, queueName).Result()
+	if err != nil {
+		return nil, err
+	}
+	return b.receiveQueueMessage(queueName, result[1])
+}
+
+// waitReliableMessage waits for message with BLMOVE to consumer processing list and stores its visibility deadline.
+// BLMOVE cant be used in script, so message of consumer crashed before deadline is stored gets deadline from reaper
+func (b *RedisBroker) waitReliableMessage(queueName string) (*CabbageMessage, error) {
+	if err := b.heartbeat(queueName); err != nil {
+		return nil, err
+	}
+	item, err := b.client.BLMove(b.ctx, queueName, b.processingListName(queueName, b.consumerID), "LEFT", "RIGHT", redisBlockTimeout).Result()
+	if err != nil {
+		return nil, err
+	}
+	z := redis.Z{Score: float64(time.Now().Add(b.visibilityTimeout).UnixMilli()), Member: item}
+	if err := b.client.ZAdd(b.ctx, b.inflightSetName(queueName, b.consumerID), z).Err(); err != nil {
+		// message stays in processing list and is returned to queue by reaper
+		return nil, err
+	}
+	return b.receiveReliableMessage(queueName, item)
+}
+
+// getReliableMessage atomically move message from queue to consumer processing list
+func (b *RedisBroker) getReliableMessage(queueName string) (*CabbageMessage, error) {
+	if err := b.heartbeat(queueName); err != nil {
+		return nil, err
+	}
+	keys := []string{queueName, b.processingListName(queueName, b.consumerID), b.inflightSetName(queueName, b.consumerID)}
+	deadline := time.Now().Add(b.visibilityTimeout).UnixMilli()
+	item, err := reliableGetScript.Run(b.ctx, b.client, keys, deadline).Text()
+	if err != nil {
+		return nil, err
+	}
+	return b.receiveReliableMessage(queueName, item)
+}
+
+// receiveReliableMessage decode message received to consumer processing list,
+// message, which cant be decoded, is moved to dead letter list with malformed reason
+func (b *RedisBroker) receiveReliableMessage(queueName string, item string) (*CabbageMessage, error) {
+	cbMessage, err := b.decodeMessage(item)
+	if err != nil {
+		malformed := &CabbageMessage{ID: uuid.NewV4().String(), Body: []byte(item), Timestamp: time.Now()}
+		if dlErr := b.SendDeadLetter(queueName, newDeadLetterMessage(malformed, DeadLetterReasonMalformed, err)); dlErr != nil {
+			// message stays in processing list and is returned to queue by reaper
+			return nil, fmt.Errorf("cant decode message: %v, cant send it to dead letter list: %w", err, dlErr)
+		}
+		b.removeReliableMessage(queueName, item, false)
+		return nil, err
+	}
+	cbMessage.receipt = item
+	return cbMessage, nil
+}
+
+// removeReliableMessage remove received message from consumer processing list, push it back to queue if requeue
+func (b *RedisBroker) removeReliableMessage(queueName string, item string, requeue bool) error {
+	keys := []string{b.processingListName(queueName, b.consumerID), b.inflightSetName(queueName, b.consumerID), queueName}
+	requeueArg := "0"
+	if requeue {
+		requeueArg = "1"
+	}
+	return reliableAckScript.Run(b.ctx, b.client, keys, item, requeueArg).Err()
+}
+
+// AckCabbageMessage confirms received message, in reliable mode message is removed from consumer processing list
+func (b *RedisBroker) AckCabbageMessage(queueName string, cbMessage *CabbageMessage) error {
+	item, ok := cbMessage.receipt.(string)
+	if !b.reliable || !ok {
+		return nil
+	}
+	return b.removeReliableMessage(queueName, item, false)
+}
+
+// NackCabbageMessage returns message to queue head if requeue, otherwise sends it to dead letter list
+func (b *RedisBroker) NackCabbageMessage(queueName string, cbMessage *CabbageMessage, requeue bool) error {
+	item, reliable := cbMessage.receipt.(string)
+	reliable = reliable && b.reliable
+	if !requeue {
+		if err := b.SendDeadLetter(queueName, newDeadLetterMessage(cbMessage, DeadLetterReasonRejected, nil)); err != nil {
+			return err
+		}
+		if reliable {
+			return b.removeReliableMessage(queueName, item, false)
+		}
+		return nil
+	}
+	if reliable {
+		return b.removeReliableMessage(queueName, item, true)
+	}
+	data, err := b.encodeQueueMessage(queueName, cbMessage)
+	if err != nil {
+		return err
+	}
+	if b.celery {
+		return b.client.RPush(b.ctx, queueName, data).Err()
+	}
+	return b.client.LPush(b.ctx, queueName, data).Err()
+}
+
+// RejectCabbageMessage same as NackCabbageMessage for redis broker
+func (b *RedisBroker) RejectCabbageMessage(queueName string, cbMessage *CabbageMessage, requeue bool) error {
+	return b.NackCabbageMessage(queueName, cbMessage, requeue)
+}
+
+// SendDeadLetter send cabbage message to queue dead letter list
+func (b *RedisBroker) SendDeadLetter(queueName string, cbMessage *CabbageMessage) error {
+	item, err := b.encodeMessage(cbMessage)
+	if err != nil {
+		return err
+	}
+	return b.client.RPush(b.ctx, deadLetterQueueName(queueName), item).Err()
+}
+
+// GetDeadLetters returns up to limit messages from queue dead letter list
+func (b *RedisBroker) GetDeadLetters(queueName string, limit int) ([]*CabbageMessage, error) {
+	items, err := b.client.LRange(b.ctx, deadLetterQueueName(queueName), 0, int64(limit-1)).Result()
 	if err != nil {
 		return nil, err
 	}
+	messages := make([]*CabbageMessage, 0, len(items))
+	for _, item := range items {
+		cbMessage, err := b.decodeMessage(item)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, cbMessage)
+	}
+	return messages, nil
+}
+
+// RequeueDeadLetters move all messages from dead letter list back to queue
+func (b *RedisBroker) RequeueDeadLetters(queueName string) (int, error) {
+	count := 0
+	for {
+		item, err := b.client.LPop(b.ctx, deadLetterQueueName(queueName)).Result()
+		if err == redis.Nil {
+			return count, nil
+		} else if err != nil {
+			return count, err
+		}
+		cbMessage, err := b.decodeMessage(item)
+		if err != nil {
+			return count, err
+		}
+		if err := b.SendCabbageMessage(queueName, newRequeuedMessage(cbMessage)); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
+
+// PurgeDeadLetters remove queue dead letter list
+func (b *RedisBroker) PurgeDeadLetters(queueName string) (int, error) {
+	pipe := b.client.TxPipeline()
+	length := pipe.LLen(b.ctx, deadLetterQueueName(queueName))
+	pipe.Del(b.ctx, deadLetterQueueName(queueName))
+	if _, err := pipe.Exec(b.ctx); err != nil {
+		return 0, err
+	}
+	return int(length.Val()), nil
+}
+
+// encodeMessage encode cabbage message for storing in redis
+func (b *RedisBroker) encodeMessage(cbMessage *CabbageMessage) (string, error) {
+	data, err := b.codec.Marshal(cbMessage)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// encodeQueueMessage encode cabbage message for storing in queue list
+func (b *RedisBroker) encodeQueueMessage(queueName string, cbMessage *CabbageMessage) (string, error) {
+	if b.celery {
+		return encodeCeleryRedisMessage(queueName, cbMessage)
+	}
+	return b.encodeMessage(cbMessage)
+}
+
+// receiveQueueMessage decode message received from queue list,
+// celery message with future ETA is moved to delayed messages and redis.Nil is returned
+func (b *RedisBroker) receiveQueueMessage(queueName string, item string) (*CabbageMessage, error) {
+	if !b.celery {
+		return b.decodeMessage(item)
+	}
+	cbMessage, err := decodeCeleryRedisMessage(item)
+	if err != nil {
+		return nil, err
+	}
+	if cbMessage.isDelayed(time.Now()) {
+		z := redis.Z{Score: float64(cbMessage.ETA.UnixMilli()), Member: item}
+		if err := b.client.ZAdd(b.ctx, b.delayedSetName(queueName), z).Err(); err != nil {
+			return nil, err
+		}
+		return nil, redis.Nil
+	}
+	return cbMessage, nil
+}
+
+// decodeMessage decode cabbage message stored in redis, falls back to json for messages stored before codec change
+func (b *RedisBroker) decodeMessage(item string) (*CabbageMessage, error) {
 	var cbMessage CabbageMessage
-	err = json.Unmarshal([]byte(item), &cbMessage)
+	err := b.codec.Unmarshal([]byte(item), &cbMessage)
+	if err != nil && strings.HasPrefix(item, "{") {
+		cbMessage = CabbageMessage{}
+		err = json.Unmarshal([]byte(item), &cbMessage)
+	}
 	if err != nil {
 		return nil, err
 	}
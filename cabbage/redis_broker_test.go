@@ -1,6 +1,11 @@
 package cabbage
 
-import "testing"
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
 
 func TestMesssageSendAndConsumeFromRedis(t *testing.T) {
 	broker := testNewRedisBroker(t)
@@ -22,3 +27,325 @@ func TestMesssageSendAndConsumeFromRedis(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestDeadLettersInRedis(t *testing.T) {
+	broker := testNewRedisBroker(t)
+	defer broker.Close()
+	broker.PurgeDeadLetters(queueName)
+	err := broker.SendDeadLetter(queueName, newDeadLetterMessage(cbMessage, DeadLetterReasonFailed, nil))
+	if err != nil {
+		t.Fatalf("cant send dead letter to redis, %v", err)
+	}
+	deadLetters, err := broker.GetDeadLetters(queueName, 10)
+	if err != nil || len(deadLetters) != 1 {
+		t.Fatalf("cant get dead letters from redis, %v", err)
+	}
+	if deadLetters[0].ID != cbMessage.ID || deadLetters[0].DeadLetter.Reason != DeadLetterReasonFailed {
+		t.Log("Invalid dead letter in redis")
+		t.Fail()
+	}
+	count, err := broker.PurgeDeadLetters(queueName)
+	if err != nil || count != 1 {
+		t.Fatalf("cant purge dead letters in redis, %d, %v", count, err)
+	}
+}
+
+func TestReliableQueueInRedis(t *testing.T) {
+	url := os.Getenv("REDIS_HOST")
+	broker, err := NewRedisBroker(url, WithRedisReliableQueue(time.Second))
+	if err != nil {
+		t.Fatalf("cant connect to Redis, %v", err)
+	}
+	defer broker.Close()
+	reliableQueue := queueName + "_reliable"
+	broker.client.Del(broker.ctx, reliableQueue, broker.processingListName(reliableQueue, broker.consumerID), broker.inflightSetName(reliableQueue, broker.consumerID))
+	if err := broker.SendCabbageMessage(reliableQueue, cbMessage); err != nil {
+		t.Fatalf("cant send cb message to redis, %v", err)
+	}
+	msg, err := broker.GetCabbageMessage(reliableQueue)
+	if err != nil {
+		t.Fatalf("cant get cb message from redis, %v", err)
+	}
+	if n := broker.client.LLen(broker.ctx, broker.processingListName(reliableQueue, broker.consumerID)).Val(); n != 1 {
+		t.Fatalf("received message must be in processing list, got %d", n)
+	}
+	// consumer crashed, message must be returned after visibility timeout
+	time.Sleep(1100 * time.Millisecond)
+	if count, err := broker.ReapExpiredMessages(reliableQueue); err != nil || count != 1 {
+		t.Fatalf("expired message must be returned to queue, %d, %v", count, err)
+	}
+	msg, err = broker.GetCabbageMessage(reliableQueue)
+	if err != nil || msg.ID != cbMessage.ID {
+		t.Fatalf("cant get returned cb message from redis, %v", err)
+	}
+	if err := broker.AckCabbageMessage(reliableQueue, msg); err != nil {
+		t.Fatalf("cant ack cb message in redis, %v", err)
+	}
+	if n := broker.client.LLen(broker.ctx, broker.processingListName(reliableQueue, broker.consumerID)).Val(); n != 0 {
+		t.Fatalf("acked message must be removed from processing list, got %d", n)
+	}
+}
+
+func TestReliableBlockingReceiveInRedis(t *testing.T) {
+	broker, err := NewRedisBroker(os.Getenv("REDIS_HOST"), WithRedisReliableQueue(time.Minute))
+	if err != nil {
+		t.Fatalf("cant connect to Redis, %v", err)
+	}
+	defer broker.Close()
+	reliableQueue := queueName + "_reliable_blocking"
+	broker.client.Del(broker.ctx, reliableQueue, broker.processingListName(reliableQueue, broker.consumerID), broker.inflightSetName(reliableQueue, broker.consumerID))
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		broker.SendCabbageMessage(reliableQueue, cbMessage)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	msg, err := broker.GetCabbageMessageWithContext(ctx, reliableQueue)
+	if err != nil || msg.ID != cbMessage.ID {
+		t.Fatalf("cant get cb message from redis, %v", err)
+	}
+	// received message has visibility deadline, so it is returned to queue if consumer crashes
+	if n := broker.client.ZCard(broker.ctx, broker.inflightSetName(reliableQueue, broker.consumerID)).Val(); n != 1 {
+		t.Errorf("received message must have visibility deadline, got %d", n)
+	}
+	broker.AckCabbageMessage(reliableQueue, msg)
+}
+
+func TestReliableReapCrashedConsumerInRedis(t *testing.T) {
+	url := os.Getenv("REDIS_HOST")
+	crashed, err := NewRedisBroker(url, WithRedisReliableQueue(time.Second))
+	if err != nil {
+		t.Fatalf("cant connect to Redis, %v", err)
+	}
+	broker, _ := NewRedisBroker(url, WithRedisReliableQueue(time.Second))
+	defer broker.Close()
+	reliableQueue := queueName + "_reliable_crashed"
+	broker.client.Del(broker.ctx, reliableQueue, broker.consumersSetName(reliableQueue))
+	// consumer crashed after BLMOVE, before visibility deadline is stored
+	if err := crashed.heartbeat(reliableQueue); err != nil {
+		t.Fatalf("cant register consumer, %v", err)
+	}
+	item, _ := crashed.encodeMessage(cbMessage)
+	crashed.client.RPush(crashed.ctx, crashed.processingListName(reliableQueue, crashed.consumerID), item)
+	crashed.Close()
+
+	if count, err := broker.ReapExpiredMessages(reliableQueue); err != nil || count != 0 {
+		t.Fatalf("message without deadline must not be returned at once, %d, %v", count, err)
+	}
+	if n := broker.client.ZCard(broker.ctx, broker.inflightSetName(reliableQueue, crashed.consumerID)).Val(); n != 1 {
+		t.Fatalf("message without deadline must get deadline from reaper, got %d", n)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if count, err := broker.ReapExpiredMessages(reliableQueue); err != nil || count != 1 {
+		t.Fatalf("message of crashed consumer must be returned to queue, %d, %v", count, err)
+	}
+	msg, err := broker.GetCabbageMessage(reliableQueue)
+	if err != nil || msg.ID != cbMessage.ID {
+		t.Fatalf("cant get returned cb message from redis, %v", err)
+	}
+	broker.AckCabbageMessage(reliableQueue, msg)
+}
+
+func TestReliableMalformedMessageInRedis(t *testing.T) {
+	broker, err := NewRedisBroker(os.Getenv("REDIS_HOST"), WithRedisReliableQueue(time.Minute))
+	if err != nil {
+		t.Fatalf("cant connect to Redis, %v", err)
+	}
+	defer broker.Close()
+	reliableQueue := queueName + "_reliable_malformed"
+	broker.client.Del(broker.ctx, reliableQueue)
+	broker.PurgeDeadLetters(reliableQueue)
+	broker.client.RPush(broker.ctx, reliableQueue, "malformed")
+	if _, err := broker.GetCabbageMessage(reliableQueue); err == nil {
+		t.Fatal("malformed message must not be received")
+	}
+	deadLetters, err := broker.GetDeadLetters(reliableQueue, 10)
+	if err != nil || len(deadLetters) != 1 || deadLetters[0].DeadLetter.Reason != DeadLetterReasonMalformed || string(deadLetters[0].Body) != "malformed" {
+		t.Fatalf("malformed message must be moved to dead letter list, got %+v, %v", deadLetters, err)
+	}
+	if n := broker.client.LLen(broker.ctx, broker.processingListName(reliableQueue, broker.consumerID)).Val(); n != 0 {
+		t.Errorf("malformed message must be removed from processing list, got %d", n)
+	}
+}
+
+func TestOrderingInRedis(t *testing.T) {
+	broker := testNewRedisBroker(t)
+	defer broker.Close()
+	broker.client.Del(broker.ctx, queueName+"_fifo")
+	testBrokerOrdering(t, broker, queueName+"_fifo", 5, false)
+
+	lifoBroker, err := NewRedisBroker(os.Getenv("REDIS_HOST"), WithRedisLIFO())
+	if err != nil {
+		t.Fatalf("cant connect to Redis, %v", err)
+	}
+	defer lifoBroker.Close()
+	lifoBroker.client.Del(lifoBroker.ctx, queueName+"_lifo")
+	testBrokerOrdering(t, lifoBroker, queueName+"_lifo", 5, true)
+}
+
+func TestBlockingReceiveFromRedis(t *testing.T) {
+	broker := testNewRedisBroker(t)
+	defer broker.Close()
+	blockingQueue := queueName + "_blocking"
+	broker.client.Del(broker.ctx, blockingQueue)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		broker.SendCabbageMessage(blockingQueue, cbMessage)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	msg, err := broker.GetCabbageMessageWithContext(ctx, blockingQueue)
+	if err != nil {
+		t.Fatalf("cant get cb message from redis, %v", err)
+	}
+	if msg.ID != cbMessage.ID {
+		t.Log("Invalid ids in redis")
+		t.Fail()
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := broker.GetCabbageMessageWithContext(ctx, blockingQueue); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestDelayedMessageInRedis(t *testing.T) {
+	broker := testNewRedisBroker(t)
+	defer broker.Close()
+	delayedQueue := queueName + "_delayed"
+	broker.client.Del(broker.ctx, delayedQueue, broker.delayedSetName(delayedQueue))
+	delayed := newCabbageMessage(taskName, body)
+	eta := time.Now().Add(500 * time.Millisecond)
+	delayed.ETA = &eta
+	if err := broker.SendCabbageMessage(delayedQueue, delayed); err != nil {
+		t.Fatalf("cant send delayed cb message to redis, %v", err)
+	}
+	if _, err := broker.GetCabbageMessage(delayedQueue); err == nil {
+		t.Fatal("delayed message must not be delivered before ETA")
+	}
+	time.Sleep(600 * time.Millisecond)
+	msg, err := broker.GetCabbageMessage(delayedQueue)
+	if err != nil {
+		t.Fatalf("cant get delayed cb message from redis, %v", err)
+	}
+	if msg.ID != delayed.ID {
+		t.Log("Invalid ids in redis")
+		t.Fail()
+	}
+}
+
+func TestHeadersInRedis(t *testing.T) {
+	broker := testNewRedisBroker(t)
+	defer broker.Close()
+	msg := newCabbageMessage(taskName, body)
+	msg.Headers = map[string]string{"correlation-id": "42", "tenant": "acme"}
+	if err := broker.SendCabbageMessage(queueName, msg); err != nil {
+		t.Fatalf("cant send cb message to redis, %v", err)
+	}
+	received, err := broker.GetCabbageMessage(queueName)
+	if err != nil {
+		t.Fatalf("cant get cb message from redis, %v", err)
+	}
+	if received.Headers["correlation-id"] != "42" || received.Headers["tenant"] != "acme" {
+		t.Errorf("invalid headers in redis %v", received.Headers)
+	}
+}
+
+func TestCodecInRedis(t *testing.T) {
+	jsonBroker := testNewRedisBroker(t)
+	defer jsonBroker.Close()
+	broker, err := NewRedisBroker(os.Getenv("REDIS_HOST"), WithRedisCodec(MsgpackCodec{}))
+	if err != nil {
+		t.Fatalf("cant create redis broker, %v", err)
+	}
+	defer broker.Close()
+	// message stored with json before codec change
+	if err := jsonBroker.SendCabbageMessage(queueName, cbMessage); err != nil {
+		t.Fatalf("cant send cb message to redis, %v", err)
+	}
+	msg := newCabbageMessage(taskName, body)
+	msg.ContentType = ContentTypeMsgpack
+	if err := broker.SendCabbageMessage(queueName, msg); err != nil {
+		t.Fatalf("cant send cb message to redis, %v", err)
+	}
+	for _, expected := range []*CabbageMessage{cbMessage, msg} {
+		received, err := broker.GetCabbageMessage(queueName)
+		if err != nil {
+			t.Fatalf("cant get cb message from redis, %v", err)
+		}
+		if received.ID != expected.ID || string(received.Body) != string(expected.Body) || received.ContentType != expected.ContentType {
+			t.Errorf("invalid message in redis %+v", received)
+		}
+	}
+}
+
+func TestCompressionInRedis(t *testing.T) {
+	broker := testNewRedisBroker(t)
+	defer broker.Close()
+	msg := newCabbageMessage(taskName, body)
+	(&compression{compressor: ZstdCompressor{}}).compress(msg)
+	if err := broker.SendCabbageMessage(queueName, msg); err != nil {
+		t.Fatalf("cant send cb message to redis, %v", err)
+	}
+	received, err := broker.GetCabbageMessage(queueName)
+	if err != nil {
+		t.Fatalf("cant get cb message from redis, %v", err)
+	}
+	decompressed, err := decompressBody(received)
+	if err != nil || received.ContentEncoding != ContentEncodingZstd || string(decompressed) != string(body) {
+		t.Errorf("invalid compressed message in redis %+v, %v", received, err)
+	}
+}
+
+func TestCeleryProtocolInRedis(t *testing.T) {
+	broker, err := NewRedisBroker(os.Getenv("REDIS_HOST"), WithRedisCeleryProtocol())
+	if err != nil {
+		t.Fatalf("cant create redis broker, %v", err)
+	}
+	defer broker.Close()
+	celeryQueue := queueName + "_celery"
+	broker.client.Del(broker.ctx, celeryQueue, broker.delayedSetName(celeryQueue))
+	// celery producer pushes messages to list head
+	if err := broker.client.LPush(broker.ctx, celeryQueue, pythonCeleryRedisMessage("null")).Err(); err != nil {
+		t.Fatalf("cant push celery message to redis, %v", err)
+	}
+	msg := newCabbageMessage("tasks.mul", []byte(`{"x": 2}`))
+	if err := broker.SendCabbageMessage(celeryQueue, msg); err != nil {
+		t.Fatalf("cant send cb message to redis, %v", err)
+	}
+	head, err := broker.client.LIndex(broker.ctx, celeryQueue, 0).Result()
+	if err != nil {
+		t.Fatalf("cant get celery message from redis, %v", err)
+	}
+	if _, err := decodeCeleryRedisMessage(head); err != nil {
+		t.Errorf("message must be pushed to list head as celery message, %v", err)
+	}
+	for _, expected := range []string{"tasks.add", "tasks.mul"} {
+		received, err := broker.GetCabbageMessageWithContext(context.Background(), celeryQueue)
+		if err != nil {
+			t.Fatalf("cant get cb message from redis, %v", err)
+		}
+		if received.TaskName != expected {
+			t.Errorf("invalid order of celery messages, expected %s, got %s", expected, received.TaskName)
+		}
+	}
+	// celery message with future eta waits in delayed set
+	delayed := newCabbageMessage(taskName, body)
+	eta := time.Now().Add(time.Second)
+	delayed.ETA = &eta
+	if err := broker.SendCabbageMessage(celeryQueue, delayed); err != nil {
+		t.Fatalf("cant send cb message to redis, %v", err)
+	}
+	if _, err := broker.GetCabbageMessage(celeryQueue); err == nil {
+		t.Fatal("delayed celery message must not be received before eta")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	received, err := broker.GetCabbageMessageWithContext(ctx, celeryQueue)
+	if err != nil || received.ID != delayed.ID {
+		t.Fatalf("cant get delayed celery message from redis, %v", err)
+	}
+	if _, err := NewRedisBroker(os.Getenv("REDIS_HOST"), WithRedisCeleryProtocol(), WithRedisLIFO()); err == nil {
+		t.Error("celery protocol must not be used with LIFO mode")
+	}
+}
@@ -0,0 +1,82 @@
+package cabbage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// acquireDedupKeyScript set dedup key if it is absent, returns acquired flag and task ID stored under key
+var acquireDedupKeyScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return {1, ARGV[1]}
+end
+return {0, redis.call('GET', KEYS[1])}
+`)
+
+// releaseDedupKeyScript delete dedup key, if it is stored with task ID
+var releaseDedupKeyScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisDedupStore is DedupStore for redis
+type RedisDedupStore struct {
+	client *redis.Client
+	ctx    context.Context
+}
+
+// NewRedisDedupStoreWithContext creates with given redis connection with context
+func NewRedisDedupStoreWithContext(ctx context.Context, url string) (*RedisDedupStore, error) {
+	client, err := newRedisClient(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisDedupStore{
+		client: client,
+		ctx:    ctx,
+	}, nil
+}
+
+// NewRedisDedupStore creates with given redis connection
+func NewRedisDedupStore(url string) (*RedisDedupStore, error) {
+	return NewRedisDedupStoreWithContext(context.Background(), url)
+}
+
+// dedupKey generate key of unique task
+func (s *RedisDedupStore) dedupKey(key string) string {
+	return fmt.Sprintf("cabbage_unique_%s", key)
+}
+
+// Acquire store task ID under key for ttl if key is absent
+func (s *RedisDedupStore) Acquire(key, ID string, ttl time.Duration) (string, bool, error) {
+	// SET PX rejects zero ttl, so ttl shorter than 1ms is rounded up
+	ttlMs := ttl.Milliseconds()
+	if ttlMs < 1 {
+		ttlMs = 1
+	}
+	res, err := acquireDedupKeyScript.Run(s.ctx, s.client, []string{s.dedupKey(key)}, ID, ttlMs).Slice()
+	if err != nil {
+		return "", false, err
+	}
+	if len(res) != 2 {
+		return "", false, fmt.Errorf("invalid dedup key %s acquire result %v", key, res)
+	}
+	acquired, _ := res[0].(int64)
+	existingID, _ := res[1].(string)
+	return existingID, acquired == 1, nil
+}
+
+// Release remove key, if it is stored with task ID
+func (s *RedisDedupStore) Release(key, ID string) error {
+	return releaseDedupKeyScript.Run(s.ctx, s.client, []string{s.dedupKey(key)}, ID).Err()
+}
+
+// Close redis dedup store
+func (s *RedisDedupStore) Close() {
+	s.client.Close()
+}
@@ -0,0 +1,15 @@
+package cabbage
+
+import (
+	"os"
+	"testing"
+)
+
+func TestDedupStoreInRedis(t *testing.T) {
+	store, err := NewRedisDedupStore(os.Getenv("REDIS_HOST"))
+	if err != nil {
+		t.Fatalf("cant connect to Redis, %v", err)
+	}
+	defer store.Close()
+	testDedupStore(t, store)
+}
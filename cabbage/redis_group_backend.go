@@ -0,0 +1,151 @@
+package cabbage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// completeGroupTaskScript store group task result once and increment succeeded or failed counter,
+// returns stored flag, group size, succeeded and failed counts
+var completeGroupTaskScript = redis.NewScript(`
+local size = tonumber(redis.call('HGET', KEYS[1], 'size'))
+if not size then
+	return false
+end
+local index = tonumber(ARGV[1])
+if index < 0 or index >= size then
+	return redis.error_reply('invalid group task index ' .. ARGV[1])
+end
+local stored = redis.call('HSETNX', KEYS[2], ARGV[1], ARGV[2])
+if stored == 1 then
+	redis.call('HINCRBY', KEYS[1], ARGV[3], 1)
+	local ttl = redis.call('PTTL', KEYS[1])
+	if ttl > 0 then
+		redis.call('PEXPIRE', KEYS[2], ttl)
+	end
+end
+local progress = redis.call('HMGET', KEYS[1], 'size', 'succeeded', 'failed')
+return {stored, tonumber(progress[1]), tonumber(progress[2]), tonumber(progress[3])}
+`)
+
+// RedisGroupBackend is GroupBackend for redis
+type RedisGroupBackend struct {
+	client  *redis.Client
+	ctx     context.Context
+	expires time.Duration
+}
+
+// NewRedisGroupBackendWithContext creates with given redis connection with context, groups expire after expires (0 - never)
+func NewRedisGroupBackendWithContext(ctx context.Context, url string, expires time.Duration) (*RedisGroupBackend, error) {
+	client, err := newRedisClient(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisGroupBackend{
+		client:  client,
+		ctx:     ctx,
+		expires: expires,
+	}, nil
+}
+
+// NewRedisGroupBackend creates with given redis connection, groups expire after expires (0 - never)
+func NewRedisGroupBackend(url string, expires time.Duration) (*RedisGroupBackend, error) {
+	return NewRedisGroupBackendWithContext(context.Background(), url, expires)
+}
+
+// groupKey generate key of group hash with group tasks and progress counters
+func (b *RedisGroupBackend) groupKey(groupID string) string {
+	return fmt.Sprintf("cabbage_group_%s", groupID)
+}
+
+// groupResultsKey generate key of group hash with group tasks results by task index
+func (b *RedisGroupBackend) groupResultsKey(groupID string) string {
+	return fmt.Sprintf("cabbage_group_%s_results", groupID)
+}
+
+// CreateGroup store new group
+func (b *RedisGroupBackend) CreateGroup(group *GroupState) error {
+	taskIDs, err := json.Marshal(group.TaskIDs)
+	if err != nil {
+		return err
+	}
+	callback, err := json.Marshal(group.Callback)
+	if err != nil {
+		return err
+	}
+	pipe := b.client.TxPipeline()
+	pipe.HSet(b.ctx, b.groupKey(group.ID), "size", group.Size, "succeeded", 0, "failed", 0, "taskIds", string(taskIDs), "callback", string(callback))
+	if b.expires > 0 {
+		pipe.Expire(b.ctx, b.groupKey(group.ID), b.expires)
+	}
+	_, err = pipe.Exec(b.ctx)
+	return err
+}
+
+// CompleteGroupTask store final result of group task
+func (b *RedisGroupBackend) CompleteGroupTask(groupID string, index int, result *GroupTaskResult) (GroupProgress, bool, error) {
+	js, err := json.Marshal(result)
+	if err != nil {
+		return GroupProgress{}, false, err
+	}
+	counter := "failed"
+	if result.Success {
+		counter = "succeeded"
+	}
+	keys := []string{b.groupKey(groupID), b.groupResultsKey(groupID)}
+	values, err := completeGroupTaskScript.Run(b.ctx, b.client, keys, index, string(js), counter).Int64Slice()
+	if err == redis.Nil {
+		return GroupProgress{}, false, ErrGroupNotFound
+	} else if err != nil {
+		return GroupProgress{}, false, err
+	}
+	progress := GroupProgress{Size: int(values[1]), Succeeded: int(values[2]), Failed: int(values[3])}
+	return progress, values[0] == 1, nil
+}
+
+// GetGroup get group state
+func (b *RedisGroupBackend) GetGroup(groupID string) (*GroupState, error) {
+	pipe := b.client.Pipeline()
+	groupCmd := pipe.HGetAll(b.ctx, b.groupKey(groupID))
+	resultsCmd := pipe.HGetAll(b.ctx, b.groupResultsKey(groupID))
+	if _, err := pipe.Exec(b.ctx); err != nil {
+		return nil, err
+	}
+	fields := groupCmd.Val()
+	if len(fields) == 0 {
+		return nil, ErrGroupNotFound
+	}
+	group := &GroupState{ID: groupID}
+	group.Size, _ = strconv.Atoi(fields["size"])
+	group.Succeeded, _ = strconv.Atoi(fields["succeeded"])
+	group.Failed, _ = strconv.Atoi(fields["failed"])
+	if err := json.Unmarshal([]byte(fields["taskIds"]), &group.TaskIDs); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(fields["callback"]), &group.Callback); err != nil {
+		return nil, err
+	}
+	group.Results = make([]*GroupTaskResult, group.Size)
+	for field, item := range resultsCmd.Val() {
+		index, err := strconv.Atoi(field)
+		if err != nil || index < 0 || index >= group.Size {
+			return nil, fmt.Errorf("invalid group %s task index %s", groupID, field)
+		}
+		var result GroupTaskResult
+		if err := json.Unmarshal([]byte(item), &result); err != nil {
+			return nil, err
+		}
+		group.Results[index] = &result
+	}
+	return group, nil
+}
+
+// Close redis group backend
+func (b *RedisGroupBackend) Close() {
+	b.client.Close()
+}
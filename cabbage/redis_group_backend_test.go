@@ -0,0 +1,19 @@
+package cabbage
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestGroupBackendInRedis(t *testing.T) {
+	backend, err := NewRedisGroupBackend(os.Getenv("REDIS_HOST"), time.Minute)
+	if err != nil {
+		t.Fatalf("cant connect to Redis, %v", err)
+	}
+	defer backend.Close()
+	testGroupBackend(t, backend)
+	if _, err := backend.GetGroup("missing"); err != ErrGroupNotFound {
+		t.Errorf("expected ErrGroupNotFound, got %v", err)
+	}
+}
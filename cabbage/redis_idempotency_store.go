@@ -0,0 +1,58 @@
+package cabbage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisIdempotencyStore is IdempotencyStore for redis
+type RedisIdempotencyStore struct {
+	client  *redis.Client
+	ctx     context.Context
+	expires time.Duration
+}
+
+// NewRedisIdempotencyStoreWithContext creates with given redis connection with context, processed IDs expire after expires (0 - never)
+func NewRedisIdempotencyStoreWithContext(ctx context.Context, url string, expires time.Duration) (*RedisIdempotencyStore, error) {
+	client, err := newRedisClient(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisIdempotencyStore{
+		client:  client,
+		ctx:     ctx,
+		expires: expires,
+	}, nil
+}
+
+// NewRedisIdempotencyStore creates with given redis connection, processed IDs expire after expires (0 - never)
+func NewRedisIdempotencyStore(url string, expires time.Duration) (*RedisIdempotencyStore, error) {
+	return NewRedisIdempotencyStoreWithContext(context.Background(), url, expires)
+}
+
+// processedKey generate key of processed task message
+func (s *RedisIdempotencyStore) processedKey(ID string) string {
+	return fmt.Sprintf("cabbage_processed_%s", ID)
+}
+
+// MarkProcessed record that task message is processed
+func (s *RedisIdempotencyStore) MarkProcessed(ID string) error {
+	return s.client.Set(s.ctx, s.processedKey(ID), "1", s.expires).Err()
+}
+
+// IsProcessed checks that task message is processed
+func (s *RedisIdempotencyStore) IsProcessed(ID string) (bool, error) {
+	n, err := s.client.Exists(s.ctx, s.processedKey(ID)).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Close redis idempotency store
+func (s *RedisIdempotencyStore) Close() {
+	s.client.Close()
+}
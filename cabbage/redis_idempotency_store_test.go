@@ -0,0 +1,16 @@
+package cabbage
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyStoreInRedis(t *testing.T) {
+	store, err := NewRedisIdempotencyStore(os.Getenv("REDIS_HOST"), time.Minute)
+	if err != nil {
+		t.Fatalf("cant connect to Redis, %v", err)
+	}
+	defer store.Close()
+	testIdempotencyStore(t, store)
+}
@@ -0,0 +1,78 @@
+package cabbage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeTokenScript take token from task token bucket, bucket is refilled with ARGV[1] tokens per ARGV[2] milliseconds,
+// returns zero if token is taken, otherwise milliseconds until token is available. Redis time is used,
+// so buckets do not depend on workers clocks
+var takeTokenScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) * 1000 + math.floor(tonumber(clock[2]) / 1000)
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updatedAt')
+local tokens = tonumber(bucket[1]) or capacity
+local updatedAt = tonumber(bucket[2]) or now
+local rate = capacity / period
+tokens = math.min(capacity, tokens + math.max(0, now - updatedAt) * rate)
+local delay = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	delay = math.ceil((1 - tokens) / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updatedAt', now)
+redis.call('PEXPIRE', KEYS[1], period)
+return delay
+`)
+
+// RedisRateLimiter is RateLimiter for redis, token buckets are shared by all workers
+type RedisRateLimiter struct {
+	client *redis.Client
+	ctx    context.Context
+}
+
+// NewRedisRateLimiterWithContext creates with given redis connection with context
+func NewRedisRateLimiterWithContext(ctx context.Context, url string) (*RedisRateLimiter, error) {
+	client, err := newRedisClient(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisRateLimiter{
+		client: client,
+		ctx:    ctx,
+	}, nil
+}
+
+// NewRedisRateLimiter creates with given redis connection
+func NewRedisRateLimiter(url string) (*RedisRateLimiter, error) {
+	return NewRedisRateLimiterWithContext(context.Background(), url)
+}
+
+// bucketKey generate key of token bucket
+func (l *RedisRateLimiter) bucketKey(key string) string {
+	return fmt.Sprintf("cabbage_rate_limit_%s", key)
+}
+
+// Allow take token from bucket of key, bucket is refilled with limit count tokens per limit period
+func (l *RedisRateLimiter) Allow(key string, limit RateLimit) (time.Duration, error) {
+	if limit.Count <= 0 || limit.Period < time.Millisecond {
+		return 0, fmt.Errorf("invalid rate limit %s, period must be at least 1ms", limit)
+	}
+	delay, err := takeTokenScript.Run(l.ctx, l.client, []string{l.bucketKey(key)}, limit.Count, limit.Period.Milliseconds()).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(delay) * time.Millisecond, nil
+}
+
+// Close redis rate limiter
+func (l *RedisRateLimiter) Close() {
+	l.client.Close()
+}
@@ -0,0 +1,15 @@
+package cabbage
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRateLimiterInRedis(t *testing.T) {
+	limiter, err := NewRedisRateLimiter(os.Getenv("REDIS_HOST"))
+	if err != nil {
+		t.Fatalf("cant connect to Redis, %v", err)
+	}
+	defer limiter.Close()
+	testRateLimiter(t, limiter)
+}
@@ -0,0 +1,69 @@
+package cabbage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisResultBackend is ResultBackend for redis
+type RedisResultBackend struct {
+	client  *redis.Client
+	ctx     context.Context
+	expires time.Duration
+}
+
+// NewRedisResultBackendWithContext creates with given redis connection with context, results expire after expires (0 - never)
+func NewRedisResultBackendWithContext(ctx context.Context, url string, expires time.Duration) (*RedisResultBackend, error) {
+	client, err := newRedisClient(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisResultBackend{
+		client:  client,
+		ctx:     ctx,
+		expires: expires,
+	}, nil
+}
+
+// NewRedisResultBackend creates with given redis connection, results expire after expires (0 - never)
+func NewRedisResultBackend(url string, expires time.Duration) (*RedisResultBackend, error) {
+	return NewRedisResultBackendWithContext(context.Background(), url, expires)
+}
+
+// resultKey generate task result key
+func (b *RedisResultBackend) resultKey(ID string) string {
+	return fmt.Sprintf("cabbage_result_%s", ID)
+}
+
+// SetTaskResult store task result
+func (b *RedisResultBackend) SetTaskResult(result *TaskResult) error {
+	js, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return b.client.Set(b.ctx, b.resultKey(result.ID), string(js), b.expires).Err()
+}
+
+// GetTaskResult get task result
+func (b *RedisResultBackend) GetTaskResult(ID string) (*TaskResult, error) {
+	item, err := b.client.Get(b.ctx, b.resultKey(ID)).Result()
+	if err == redis.Nil {
+		return nil, ErrResultNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var result TaskResult
+	if err := json.Unmarshal([]byte(item), &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close redis result backend
+func (b *RedisResultBackend) Close() {
+	b.client.Close()
+}
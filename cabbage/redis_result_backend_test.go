@@ -0,0 +1,31 @@
+package cabbage
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestResultBackendInRedis(t *testing.T) {
+	backend, err := NewRedisResultBackend(os.Getenv("REDIS_HOST"), time.Minute)
+	if err != nil {
+		t.Fatalf("cant connect to Redis, %v", err)
+	}
+	defer backend.Close()
+	if _, err := backend.GetTaskResult("missing"); err != ErrResultNotFound {
+		t.Fatalf("expected ErrResultNotFound, got %v", err)
+	}
+	taskResult := newTaskResult(cbMessage, TaskStateSuccess)
+	taskResult.Result = []byte("result")
+	if err := backend.SetTaskResult(taskResult); err != nil {
+		t.Fatalf("cant set task result in redis, %v", err)
+	}
+	stored, err := backend.GetTaskResult(cbMessage.ID)
+	if err != nil {
+		t.Fatalf("cant get task result from redis, %v", err)
+	}
+	if stored.State != TaskStateSuccess || string(stored.Result) != "result" {
+		t.Log("Invalid task result in redis")
+		t.Fail()
+	}
+}
@@ -0,0 +1,67 @@
+package cabbage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// revokeTerminate value of revocation key for tasks revoked with terminate
+const revokeTerminate = "terminate"
+
+// RedisRevokeStore is RevokeStore for redis
+type RedisRevokeStore struct {
+	client  *redis.Client
+	ctx     context.Context
+	expires time.Duration
+}
+
+// NewRedisRevokeStoreWithContext creates with given redis connection with context, revocations expire after expires (0 - never)
+func NewRedisRevokeStoreWithContext(ctx context.Context, url string, expires time.Duration) (*RedisRevokeStore, error) {
+	client, err := newRedisClient(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisRevokeStore{
+		client:  client,
+		ctx:     ctx,
+		expires: expires,
+	}, nil
+}
+
+// NewRedisRevokeStore creates with given redis connection, revocations expire after expires (0 - never)
+func NewRedisRevokeStore(url string, expires time.Duration) (*RedisRevokeStore, error) {
+	return NewRedisRevokeStoreWithContext(context.Background(), url, expires)
+}
+
+// revokeKey generate key of task revocation
+func (s *RedisRevokeStore) revokeKey(ID string) string {
+	return fmt.Sprintf("cabbage_revoked_%s", ID)
+}
+
+// Revoke marks task ID as revoked
+func (s *RedisRevokeStore) Revoke(ID string, terminate bool) error {
+	value := "1"
+	if terminate {
+		value = revokeTerminate
+	}
+	return s.client.Set(s.ctx, s.revokeKey(ID), value, s.expires).Err()
+}
+
+// IsRevoked checks that task ID is revoked
+func (s *RedisRevokeStore) IsRevoked(ID string) (bool, bool, error) {
+	value, err := s.client.Get(s.ctx, s.revokeKey(ID)).Result()
+	if err == redis.Nil {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, err
+	}
+	return true, value == revokeTerminate, nil
+}
+
+// Close redis revoke store
+func (s *RedisRevokeStore) Close() {
+	s.client.Close()
+}
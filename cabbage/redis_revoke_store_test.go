@@ -0,0 +1,16 @@
+package cabbage
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRevokeStoreInRedis(t *testing.T) {
+	store, err := NewRedisRevokeStore(os.Getenv("REDIS_HOST"), time.Minute)
+	if err != nil {
+		t.Fatalf("cant connect to Redis, %v", err)
+	}
+	defer store.Close()
+	testRevokeStore(t, store)
+}
@@ -0,0 +1,193 @@
+package cabbage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TaskState state of task execution
+type TaskState string
+
+// task states
+const (
+	TaskStatePending TaskState = "PENDING" // task is published, but not started
+	TaskStateStarted TaskState = "STARTED" // task is proccessed by worker
+	TaskStateSuccess TaskState = "SUCCESS" // task succeeded
+	TaskStateFailure TaskState = "FAILURE" // task failed and will not be retried
+	TaskStateRetry   TaskState = "RETRY"   // task failed and will be retried
+	TaskStateRevoked TaskState = "REVOKED" // task was revoked and skipped or terminated by worker
+)
+
+// IsReady checks that task state is final
+func (s TaskState) IsReady() bool {
+	return s == TaskStateSuccess || s == TaskStateFailure || s == TaskStateRevoked
+}
+
+var (
+	// ErrResultNotFound returned by ResultBackend when task result is missing
+	ErrResultNotFound = errors.New("task result not found")
+	// ErrNoResultBackend returned by AsyncResult when result backend is not set
+	ErrNoResultBackend = errors.New("result backend is not set")
+	// ErrResultTimeout returned by AsyncResult.Wait when task is not ready in time
+	ErrResultTimeout = errors.New("task result timeout")
+)
+
+// resultPollPeriod period of result backend polling while waiting for task result
+const resultPollPeriod = 50 * time.Millisecond
+
+// TaskResult task execution result stored in ResultBackend
+type TaskResult struct {
+	ID          string     `json:"id"`
+	TaskName    string     `json:"taskName"`
+	State       TaskState  `json:"state"`
+	Result      []byte     `json:"result,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	Retries     int        `json:"retries"`
+	PublishedAt time.Time  `json:"publishedAt"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+}
+
+// newTaskResult create TaskResult for message in state
+func newTaskResult(cbMessage *CabbageMessage, state TaskState) *TaskResult {
+	return &TaskResult{
+		ID:          cbMessage.ID,
+		TaskName:    cbMessage.TaskName,
+		State:       state,
+		Retries:     cbMessage.Retries,
+		PublishedAt: cbMessage.Timestamp,
+	}
+}
+
+// TaskFailedError returned by AsyncResult.Get when task failed
+type TaskFailedError struct {
+	ID      string
+	Message string // task error text
+}
+
+func (e *TaskFailedError) Error() string {
+	return fmt.Sprintf("task %s failed: %s", e.ID, e.Message)
+}
+
+// ResultBackend is interface for task results storage, results are keyed by CabbageMessage.ID
+type ResultBackend interface {
+	SetTaskResult(result *TaskResult) error
+	// GetTaskResult returns ErrResultNotFound if result is missing
+	GetTaskResult(ID string) (*TaskResult, error)
+}
+
+// TaskResultProccesser interface for proccess consume message with result, result is stored in ResultBackend
+type TaskResultProccesser interface {
+	ProccessTaskWithResult(ctx context.Context, body []byte, ID string) ([]byte, error)
+}
+
+// AsyncResult handle of published task result
+type AsyncResult struct {
+	ID      string
+	backend ResultBackend
+}
+
+// newAsyncResult construct AsyncResult
+func newAsyncResult(ID string, backend ResultBackend) *AsyncResult {
+	return &AsyncResult{ID: ID, backend: backend}
+}
+
+// Result returns current task result
+func (r *AsyncResult) Result() (*TaskResult, error) {
+	if r.backend == nil {
+		return nil, ErrNoResultBackend
+	}
+	return r.backend.GetTaskResult(r.ID)
+}
+
+// State returns current task state, PENDING if result is missing
+func (r *AsyncResult) State() (TaskState, error) {
+	result, err := r.Result()
+	if err == ErrResultNotFound {
+		return TaskStatePending, nil
+	} else if err != nil {
+		return "", err
+	}
+	return result.State, nil
+}
+
+// Wait waits for task final state not longer than timeout
+func (r *AsyncResult) Wait(timeout time.Duration) (*TaskResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	result, err := r.wait(ctx)
+	if err == context.DeadlineExceeded {
+		return nil, ErrResultTimeout
+	}
+	return result, err
+}
+
+// Get waits for task final state and returns task result, returns TaskFailedError if task failed
+// and ErrTaskRevoked if task was revoked
+func (r *AsyncResult) Get(ctx context.Context) ([]byte, error) {
+	result, err := r.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if result.State == TaskStateRevoked {
+		return nil, ErrTaskRevoked
+	}
+	if result.State == TaskStateFailure {
+		return nil, &TaskFailedError{ID: r.ID, Message: result.Error}
+	}
+	return result.Result, nil
+}
+
+// wait polls result backend until task is ready or context is done
+func (r *AsyncResult) wait(ctx context.Context) (*TaskResult, error) {
+	ticker := time.NewTicker(resultPollPeriod)
+	defer ticker.Stop()
+	for {
+		result, err := r.Result()
+		if err == nil && result.State.IsReady() {
+			return result, nil
+		} else if err != nil && err != ErrResultNotFound {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// MemoryResultBackend is in-memory ResultBackend for tests and single-process deployments
+type MemoryResultBackend struct {
+	lock    sync.RWMutex
+	results map[string]*TaskResult
+}
+
+// NewMemoryResultBackend create MemoryResultBackend
+func NewMemoryResultBackend() *MemoryResultBackend {
+	return &MemoryResultBackend{results: make(map[string]*TaskResult)}
+}
+
+// SetTaskResult store task result
+func (b *MemoryResultBackend) SetTaskResult(result *TaskResult) error {
+	cp := *result
+	b.lock.Lock()
+	b.results[result.ID] = &cp
+	b.lock.Unlock()
+	return nil
+}
+
+// GetTaskResult get task result
+func (b *MemoryResultBackend) GetTaskResult(ID string) (*TaskResult, error) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	result, ok := b.results[ID]
+	if !ok {
+		return nil, ErrResultNotFound
+	}
+	cp := *result
+	return &cp, nil
+}
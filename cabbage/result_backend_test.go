@@ -0,0 +1,101 @@
+package cabbage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type resultTestService struct{}
+
+func (s *resultTestService) ProccessTask(ctx context.Context, body []byte, ID string) error {
+	_, err := s.ProccessTaskWithResult(ctx, body, ID)
+	return err
+}
+
+func (s *resultTestService) ProccessTaskWithResult(ctx context.Context, body []byte, ID string) ([]byte, error) {
+	if string(body) == `{"id":"fail","site_id":""}` {
+		return nil, errors.New("result error")
+	}
+	return append([]byte("result:"), body...), nil
+}
+
+// startResultTestWorker create client with memory broker and result backend and started worker
+func startResultTestWorker(t *testing.T, task *Task) (*CabbageClient, *MemoryResultBackend) {
+	client := NewCabbageClient(NewMemoryBroker())
+	backend := NewMemoryResultBackend()
+	client.SetResultBackend(backend)
+	worker, _ := client.CreateWorker(task.QueueName, 1)
+	client.CreatePublisher()
+	task.WithPublish = true
+	client.RegisterTask(task)
+	worker.StartWorker()
+	t.Cleanup(func() {
+		worker.StopWorker()
+		client.Close()
+	})
+	return client, backend
+}
+
+func TestAsyncResultSuccess(t *testing.T) {
+	client, _ := startResultTestWorker(t, &Task{Name: taskName, QueueName: queueName, TProccesser: &resultTestService{}})
+	asyncResult, err := client.publisher.PublishTask(taskName, &testSchData{ID: "ok"})
+	if err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	result, err := asyncResult.Get(ctx)
+	if err != nil {
+		t.Fatalf("cant get task result, %v", err)
+	}
+	if string(result) != `result:{"id":"ok","site_id":""}` {
+		t.Errorf("invalid task result %s", result)
+	}
+	taskResult, err := asyncResult.Wait(time.Second)
+	if err != nil {
+		t.Fatalf("cant wait task result, %v", err)
+	}
+	if taskResult.StartedAt == nil || taskResult.FinishedAt == nil || taskResult.FinishedAt.Before(*taskResult.StartedAt) {
+		t.Errorf("invalid task result timings %+v", taskResult)
+	}
+	if state, _ := client.AsyncResult(asyncResult.ID).State(); state != TaskStateSuccess {
+		t.Errorf("invalid task state %s", state)
+	}
+}
+
+func TestAsyncResultFailure(t *testing.T) {
+	task := &Task{Name: taskName, QueueName: queueName, TProccesser: &resultTestService{}, RetryPolicy: NewRetryPolicy(2, NewFixedBackoff(300*time.Millisecond))}
+	client, _ := startResultTestWorker(t, task)
+	asyncResult, _ := client.publisher.PublishTask(taskName, &testSchData{ID: "fail"})
+	waitFor(t, func() bool {
+		state, _ := asyncResult.State()
+		return state == TaskStateRetry
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err := asyncResult.Get(ctx)
+	var failedErr *TaskFailedError
+	if !errors.As(err, &failedErr) || failedErr.Message != "result error" {
+		t.Fatalf("expected TaskFailedError, got %v", err)
+	}
+	taskResult, _ := asyncResult.Result()
+	if taskResult.Retries != 1 {
+		t.Errorf("failed task must have 1 retry, got %d", taskResult.Retries)
+	}
+}
+
+func TestAsyncResultPending(t *testing.T) {
+	backend := NewMemoryResultBackend()
+	asyncResult := newAsyncResult("missing", backend)
+	if state, err := asyncResult.State(); err != nil || state != TaskStatePending {
+		t.Errorf("missing result must be pending, got %s, %v", state, err)
+	}
+	if _, err := asyncResult.Wait(100 * time.Millisecond); err != ErrResultTimeout {
+		t.Errorf("expected ErrResultTimeout, got %v", err)
+	}
+	if _, err := newAsyncResult("missing", nil).State(); err != ErrNoResultBackend {
+		t.Errorf("expected ErrNoResultBackend, got %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package cabbage
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Backoff calculates delay before retry, retry starts from 1
+type Backoff interface {
+	Delay(retry int) time.Duration
+}
+
+// BackoffFunc adapter to use ordinary functions as Backoff
+type BackoffFunc func(retry int) time.Duration
+
+// Delay calls f(retry)
+func (f BackoffFunc) Delay(retry int) time.Duration {
+	return f(retry)
+}
+
+// RetryPolicy task retry policy
+type RetryPolicy struct {
+	MaxAttempts int // total attempts count, including first run
+	Backoff     Backoff
+}
+
+// NewRetryPolicy construct RetryPolicy
+func NewRetryPolicy(maxAttempts int, backoff Backoff) *RetryPolicy {
+	return &RetryPolicy{MaxAttempts: maxAttempts, Backoff: backoff}
+}
+
+// shouldRetry decides should the task be retried after attempt
+func (rp *RetryPolicy) shouldRetry(attempt int) bool {
+	return rp != nil && attempt < rp.MaxAttempts
+}
+
+// delay returns delay before retry
+func (rp *RetryPolicy) delay(retry int) time.Duration {
+	if rp.Backoff == nil {
+		return 0
+	}
+	return rp.Backoff.Delay(retry)
+}
+
+// NewFixedBackoff create Backoff with same delay for each retry
+func NewFixedBackoff(delay time.Duration) Backoff {
+	return BackoffFunc(func(retry int) time.Duration {
+		return delay
+	})
+}
+
+// NewExponentialBackoff create Backoff with base * 2^(retry-1) delay, limited by max (max <= 0 means no limit)
+func NewExponentialBackoff(base time.Duration, max time.Duration) Backoff {
+	return BackoffFunc(func(retry int) time.Duration {
+		return exponentialDelay(base, max, retry)
+	})
+}
+
+// NewJitterBackoff create exponential Backoff with full jitter, delay is random in [0, base * 2^(retry-1)], limited by max
+func NewJitterBackoff(base time.Duration, max time.Duration) Backoff {
+	return BackoffFunc(func(retry int) time.Duration {
+		delay := exponentialDelay(base, max, retry)
+		if delay <= 0 {
+			return 0
+		}
+		return time.Duration(rand.Int63n(int64(delay) + 1))
+	})
+}
+
+// exponentialDelay returns base * 2^(retry-1) limited by max
+func exponentialDelay(base time.Duration, max time.Duration, retry int) time.Duration {
+	if retry < 1 {
+		retry = 1
+	}
+	delay := float64(base) * math.Pow(2, float64(retry-1))
+	if max > 0 && delay > float64(max) {
+		return max
+	}
+	if delay >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(delay)
+}
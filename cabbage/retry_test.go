@@ -0,0 +1,49 @@
+package cabbage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFixedBackoff(t *testing.T) {
+	backoff := NewFixedBackoff(time.Second)
+	for retry := 1; retry < 5; retry++ {
+		if backoff.Delay(retry) != time.Second {
+			t.Errorf("invalid fixed delay for retry %d: %s", retry, backoff.Delay(retry))
+		}
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := NewExponentialBackoff(time.Second, 5*time.Second)
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, delay := range expected {
+		if backoff.Delay(i+1) != delay {
+			t.Errorf("invalid exponential delay for retry %d: %s, must be %s", i+1, backoff.Delay(i+1), delay)
+		}
+	}
+	if NewExponentialBackoff(time.Second, 0).Delay(100) <= 0 {
+		t.Error("exponential delay without max must not overflow")
+	}
+}
+
+func TestJitterBackoff(t *testing.T) {
+	backoff := NewJitterBackoff(time.Second, 3*time.Second)
+	for retry := 1; retry < 10; retry++ {
+		delay := backoff.Delay(retry)
+		if delay < 0 || delay > 3*time.Second {
+			t.Errorf("invalid jitter delay for retry %d: %s", retry, delay)
+		}
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	var empty *RetryPolicy
+	if empty.shouldRetry(1) {
+		t.Error("nil policy must not retry")
+	}
+	policy := NewRetryPolicy(3, nil)
+	if !policy.shouldRetry(1) || !policy.shouldRetry(2) || policy.shouldRetry(3) {
+		t.Error("policy with 3 max attempts must retry only after attempts 1 and 2")
+	}
+}
@@ -0,0 +1,159 @@
+package cabbage
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrTaskRevoked returned by AsyncResult.Get when task was revoked
+	ErrTaskRevoked = errors.New("task revoked")
+	// ErrNoRevokeStore returned by CabbageClient.Revoke when revoke store is not set
+	ErrNoRevokeStore = errors.New("revoke store is not set")
+)
+
+// RevokeStore is interface for revoked task IDs storage, store must be shared by workers and clients.
+// Revocations expire after store TTL
+type RevokeStore interface {
+	// Revoke marks task ID as revoked, running task is terminated if terminate
+	Revoke(ID string, terminate bool) error
+	// IsRevoked checks that task ID is revoked and returns terminate flag of revocation
+	IsRevoked(ID string) (revoked bool, terminate bool, err error)
+}
+
+// runningTask task proccessed by worker, which can be terminated by revocation
+type runningTask struct {
+	cancel  context.CancelFunc
+	revoked atomic.Bool
+}
+
+// isRevoked checks that message task is revoked, store errors are logged and message is proccessed
+func (w *CabbageWorker) isRevoked(cbMessage *CabbageMessage) bool {
+	if w.revokeStore == nil {
+		return false
+	}
+	revoked, _, err := w.revokeStore.IsRevoked(cbMessage.ID)
+	if err != nil {
+		log.Printf("[!] Queue: %s, cant check revocation of task message %s: %+v", w.queueName, cbMessage.ID, err)
+		return false
+	}
+	return revoked
+}
+
+// revokeTask store revoked result of task, stops its chain and group and acknowledges message
+func (w *CabbageWorker) revokeTask(cbMessage *CabbageMessage, taskResult *TaskResult) {
+	log.Printf("[*] Queue: %s, task %s, id %s is revoked\n", w.queueName, cbMessage.TaskName, cbMessage.ID)
+	taskResult.State = TaskStateRevoked
+	taskResult.Error = ErrTaskRevoked.Error()
+	w.setTaskResult(taskResult)
+	w.stopTask(cbMessage, ErrTaskRevoked)
+	w.ackTask(cbMessage)
+}
+
+// startRunningTask register running task, context of task is cancelled when task is revoked with terminate
+func (w *CabbageWorker) startRunningTask(ctx context.Context, ID string) (context.Context, *runningTask, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	rt := &runningTask{cancel: cancel}
+	w.runningLock.Lock()
+	w.runningTasks[rt] = ID
+	w.runningLock.Unlock()
+	return ctx, rt, func() {
+		w.runningLock.Lock()
+		delete(w.runningTasks, rt)
+		w.runningLock.Unlock()
+		cancel()
+	}
+}
+
+// watchRevocations periodically checks revocations of running tasks and terminates revoked tasks
+func (w *CabbageWorker) watchRevocations(ctx context.Context) {
+	defer w.workWG.Done()
+	ticker := time.NewTicker(w.revokeCheckPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.terminateRevokedTasks()
+		}
+	}
+}
+
+// terminateRevokedTasks cancel context of running tasks, which are revoked with terminate
+func (w *CabbageWorker) terminateRevokedTasks() {
+	w.runningLock.Lock()
+	running := make(map[*runningTask]string, len(w.runningTasks))
+	for rt, ID := range w.runningTasks {
+		running[rt] = ID
+	}
+	w.runningLock.Unlock()
+	for rt, ID := range running {
+		revoked, terminate, err := w.revokeStore.IsRevoked(ID)
+		if err != nil {
+			log.Printf("[!] Queue: %s, cant check revocation of running task %s: %+v", w.queueName, ID, err)
+			continue
+		}
+		if revoked && terminate && !rt.revoked.Swap(true) {
+			log.Printf("[*] Queue: %s, terminate revoked task %s\n", w.queueName, ID)
+			rt.cancel()
+		}
+	}
+}
+
+// memoryRevocation revocation stored in MemoryRevokeStore
+type memoryRevocation struct {
+	terminate bool
+	expiresAt time.Time // zero time - never expires
+}
+
+// expired checks that revocation is expired at now
+func (r memoryRevocation) expired(now time.Time) bool {
+	return !r.expiresAt.IsZero() && !r.expiresAt.After(now)
+}
+
+// MemoryRevokeStore is in-memory RevokeStore for tests and single-process deployments
+type MemoryRevokeStore struct {
+	lock        sync.Mutex
+	ttl         time.Duration
+	revocations map[string]memoryRevocation
+}
+
+// NewMemoryRevokeStore create MemoryRevokeStore, revocations expire after ttl (0 - never)
+func NewMemoryRevokeStore(ttl time.Duration) *MemoryRevokeStore {
+	return &MemoryRevokeStore{ttl: ttl, revocations: make(map[string]memoryRevocation)}
+}
+
+// Revoke marks task ID as revoked
+func (s *MemoryRevokeStore) Revoke(ID string, terminate bool) error {
+	now := time.Now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// expired revocations are removed on write, so store does not grow
+	for revokedID, revocation := range s.revocations {
+		if revocation.expired(now) {
+			delete(s.revocations, revokedID)
+		}
+	}
+	revocation := memoryRevocation{terminate: terminate}
+	if s.ttl > 0 {
+		revocation.expiresAt = now.Add(s.ttl)
+	}
+	s.revocations[ID] = revocation
+	return nil
+}
+
+// IsRevoked checks that task ID is revoked
+func (s *MemoryRevokeStore) IsRevoked(ID string) (bool, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	revocation, ok := s.revocations[ID]
+	if !ok || revocation.expired(time.Now()) {
+		return false, false, nil
+	}
+	return true, revocation.terminate, nil
+}
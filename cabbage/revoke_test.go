@@ -0,0 +1,102 @@
+package cabbage
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRevokePendingTask(t *testing.T) {
+	client := startTasksTestClient(t, &Task{Name: taskName, QueueName: queueName, TProccesser: &resultTestService{}})
+	asyncResult, err := client.publisher.PublishTask(taskName, &testSchData{ID: "revoked"}, Countdown(200*time.Millisecond))
+	if err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	if err := client.Revoke(asyncResult.ID, false); err != nil {
+		t.Fatalf("cant revoke task, %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := asyncResult.Get(ctx); err != ErrTaskRevoked {
+		t.Fatalf("expected ErrTaskRevoked, got %v", err)
+	}
+	if state, err := asyncResult.State(); err != nil || state != TaskStateRevoked {
+		t.Errorf("revoked task must have REVOKED state, got %s, %v", state, err)
+	}
+}
+
+func TestRevokeTerminateRunningTask(t *testing.T) {
+	started := make(chan struct{})
+	blocking := TaskProccesserFunc(func(ctx context.Context, body []byte, ID string) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	client := startTasksTestClient(t,
+		&Task{Name: "blocking", QueueName: queueName, TProccesser: blocking},
+		&Task{Name: "store", QueueName: queueName, TProccesser: &resultTestService{}},
+	)
+	chainResult, err := client.publisher.PublishChain(NewChain("blocking", "store"), &testSchData{ID: "revoked"})
+	if err != nil {
+		t.Fatalf("cant publish chain, %v", err)
+	}
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("task is not started")
+	}
+	if err := client.Revoke(chainResult.Results[0].ID, true); err != nil {
+		t.Fatalf("cant revoke task, %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := chainResult.Results[0].Get(ctx); err != ErrTaskRevoked {
+		t.Fatalf("expected ErrTaskRevoked, got %v", err)
+	}
+	index, failed, err := chainResult.FailedTask()
+	if err != nil || index != 0 || failed.State != TaskStateRevoked {
+		t.Errorf("first chain task must be revoked, got %d, %+v, %v", index, failed, err)
+	}
+	last, err := chainResult.Results[1].Result()
+	if err != nil || last.State != TaskStateFailure || !strings.Contains(last.Error, "task revoked") {
+		t.Errorf("chain must be stopped by revoked task, got %+v, %v", last, err)
+	}
+}
+
+func TestRevokeWithoutStore(t *testing.T) {
+	client := NewCabbageClient(NewMemoryBroker())
+	if err := client.Revoke("id", false); err != ErrNoRevokeStore {
+		t.Errorf("expected ErrNoRevokeStore, got %v", err)
+	}
+}
+
+func TestMemoryRevokeStore(t *testing.T) {
+	testRevokeStore(t, NewMemoryRevokeStore(time.Minute))
+	store := NewMemoryRevokeStore(time.Millisecond)
+	store.Revoke("expired", false)
+	time.Sleep(5 * time.Millisecond)
+	if revoked, _, _ := store.IsRevoked("expired"); revoked {
+		t.Error("revocation must expire")
+	}
+}
+
+// testRevokeStore checks revocations with and without terminate
+func testRevokeStore(t *testing.T, store RevokeStore) {
+	ID := newCabbageMessage(taskName, nil).ID
+	if revoked, _, err := store.IsRevoked(ID); err != nil || revoked {
+		t.Fatalf("task must not be revoked, got %v, %v", revoked, err)
+	}
+	if err := store.Revoke(ID, false); err != nil {
+		t.Fatalf("cant revoke task, %v", err)
+	}
+	if revoked, terminate, err := store.IsRevoked(ID); err != nil || !revoked || terminate {
+		t.Errorf("task must be revoked without terminate, got %v, %v, %v", revoked, terminate, err)
+	}
+	if err := store.Revoke(ID, true); err != nil {
+		t.Fatalf("cant revoke task, %v", err)
+	}
+	if revoked, terminate, err := store.IsRevoked(ID); err != nil || !revoked || !terminate {
+		t.Errorf("task must be revoked with terminate, got %v, %v, %v", revoked, terminate, err)
+	}
+}
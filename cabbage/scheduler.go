@@ -204,7 +204,12 @@ func (j *job) run() {
 	}()
 	j.RUnlock()
 	log.Printf("[*] scheduler publish task %s", j.taskName)
-	j.publisher.PublishTask(j.taskName, j.fn())
+	var duplicateErr *DuplicateTaskError
+	if _, err := j.publisher.PublishTask(j.taskName, j.fn()); errors.As(err, &duplicateErr) {
+		log.Printf("[*] scheduler skip duplicate task %s, existing task %s \n", j.taskName, duplicateErr.ExistingID)
+	} else if err != nil {
+		log.Printf("[!] scheduler cant publish task %s: %v \n", j.taskName, err)
+	}
 }
 
 // parseSchedule string and creates job struct with filled times to launch, or error if synthax is wrong
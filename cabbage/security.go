@@ -0,0 +1,262 @@
+package cabbage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+)
+
+// message headers used for signing and encryption
+const (
+	SignatureHeader          = "cabbage-signature"
+	SignatureKeyIDHeader     = "cabbage-signature-key-id"
+	EncryptionKeyIDHeader    = "cabbage-encryption-key-id"
+	securityHeaderPrefix     = "cabbage-"
+	encryptionNonceSize      = 12
+	signatureCanonicalPrefix = "cabbage-signature-v1"
+)
+
+var (
+	// ErrInvalidSignature returned when message signature is missing or does not match message
+	ErrInvalidSignature = errors.New("invalid message signature")
+	// ErrUnknownKey returned when message is signed or encrypted with key, which is missing in keyring
+	ErrUnknownKey = errors.New("unknown key id")
+)
+
+// Keyring keys by key id, new messages are signed or encrypted with current key,
+// received messages are verified or decrypted with key from message headers, so keys can be rotated
+// by adding new current key and removing old key after all old messages are proccessed
+type Keyring struct {
+	currentKeyID string
+	keys         map[string][]byte
+}
+
+// NewKeyring construct Keyring, current key must be in keys
+func NewKeyring(currentKeyID string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[currentKeyID]; !ok {
+		return nil, fmt.Errorf("current key %s is missing in keys", currentKeyID)
+	}
+	kr := &Keyring{currentKeyID: currentKeyID, keys: make(map[string][]byte, len(keys))}
+	for keyID, key := range keys {
+		kr.keys[keyID] = append([]byte(nil), key...)
+	}
+	return kr, nil
+}
+
+// key returns key by id
+func (kr *Keyring) key(keyID string) ([]byte, error) {
+	key, ok := kr.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownKey, keyID)
+	}
+	return key, nil
+}
+
+// SecurityConfig message signing and encryption settings, same config must be set on publishers and workers
+type SecurityConfig struct {
+	// SigningKeys HMAC-SHA256 keys, publishers sign messages and workers reject unsigned messages
+	// and messages with invalid signature to dead letter queue
+	SigningKeys *Keyring
+	// EncryptionKeys AES-GCM keys (16, 24 or 32 bytes), publishers encrypt message body
+	EncryptionKeys *Keyring
+}
+
+// NewSecurityConfig construct SecurityConfig and validates encryption keys, nil keyring disables signing or encryption
+func NewSecurityConfig(signingKeys *Keyring, encryptionKeys *Keyring) (*SecurityConfig, error) {
+	if encryptionKeys != nil {
+		for keyID, key := range encryptionKeys.keys {
+			if _, err := aes.NewCipher(key); err != nil {
+				return nil, fmt.Errorf("invalid encryption key %s: %w", keyID, err)
+			}
+		}
+	}
+	return &SecurityConfig{SigningKeys: signingKeys, EncryptionKeys: encryptionKeys}, nil
+}
+
+// seal encrypts and signs published message, body must be already compressed
+func (sc *SecurityConfig) seal(cbMessage *CabbageMessage) error {
+	if sc == nil {
+		return nil
+	}
+	// security headers of copied message must not be trusted
+	headers := make(map[string]string, len(cbMessage.Headers)+3)
+	for key, value := range cbMessage.Headers {
+		if !strings.HasPrefix(key, securityHeaderPrefix) {
+			headers[key] = value
+		}
+	}
+	cbMessage.Headers = headers
+	if sc.EncryptionKeys != nil {
+		if err := sc.encrypt(cbMessage); err != nil {
+			return err
+		}
+	}
+	if sc.SigningKeys != nil {
+		keyID := sc.SigningKeys.currentKeyID
+		key, _ := sc.SigningKeys.key(keyID)
+		cbMessage.Headers[SignatureKeyIDHeader] = keyID
+		cbMessage.Headers[SignatureHeader] = base64.StdEncoding.EncodeToString(messageSignature(key, cbMessage))
+	}
+	return nil
+}
+
+// resign signs message again after worker changed its ETA for retry or rate limit, body is not encrypted again.
+// Only messages verified by worker are signed again, so worker cant sign forged message
+func (sc *SecurityConfig) resign(cbMessage *CabbageMessage) {
+	if sc == nil || sc.SigningKeys == nil {
+		return
+	}
+	keyID := sc.SigningKeys.currentKeyID
+	key, _ := sc.SigningKeys.key(keyID)
+	// headers of copied message are shared with received message
+	cbMessage.Headers = copyHeaders(cbMessage.Headers)
+	if cbMessage.Headers == nil {
+		cbMessage.Headers = make(map[string]string, 2)
+	}
+	cbMessage.Headers[SignatureKeyIDHeader] = keyID
+	cbMessage.Headers[SignatureHeader] = base64.StdEncoding.EncodeToString(messageSignature(key, cbMessage))
+}
+
+// open verifies and decrypts received message body, decompression is done after open
+func (sc *SecurityConfig) open(cbMessage *CabbageMessage) ([]byte, error) {
+	if sc != nil && sc.SigningKeys != nil {
+		if err := sc.verify(cbMessage); err != nil {
+			return nil, err
+		}
+	}
+	keyID, encrypted := cbMessage.Headers[EncryptionKeyIDHeader]
+	if !encrypted {
+		return cbMessage.Body, nil
+	}
+	if sc == nil || sc.EncryptionKeys == nil {
+		return nil, errors.New("message is encrypted, but encryption keys are not set")
+	}
+	return sc.decrypt(cbMessage, keyID)
+}
+
+// verify checks message signature
+func (sc *SecurityConfig) verify(cbMessage *CabbageMessage) error {
+	signature, err := base64.StdEncoding.DecodeString(cbMessage.Headers[SignatureHeader])
+	if err != nil || len(signature) == 0 {
+		return ErrInvalidSignature
+	}
+	key, err := sc.SigningKeys.key(cbMessage.Headers[SignatureKeyIDHeader])
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if !hmac.Equal(signature, messageSignature(key, cbMessage)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// encrypt message body with current encryption key, message ID is used as additional data
+func (sc *SecurityConfig) encrypt(cbMessage *CabbageMessage) error {
+	keyID := sc.EncryptionKeys.currentKeyID
+	key, _ := sc.EncryptionKeys.key(keyID)
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, encryptionNonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	cbMessage.Body = aead.Seal(nonce, nonce, cbMessage.Body, []byte(cbMessage.ID))
+	cbMessage.Headers[EncryptionKeyIDHeader] = keyID
+	return nil
+}
+
+// decrypt message body with key from message headers
+func (sc *SecurityConfig) decrypt(cbMessage *CabbageMessage, keyID string) ([]byte, error) {
+	key, err := sc.EncryptionKeys.key(keyID)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(cbMessage.Body) < encryptionNonceSize {
+		return nil, errors.New("encrypted body is too short")
+	}
+	nonce, ciphertext := cbMessage.Body[:encryptionNonceSize], cbMessage.Body[encryptionNonceSize:]
+	return aead.Open(nil, nonce, ciphertext, []byte(cbMessage.ID))
+}
+
+// newAEAD create AES-GCM cipher
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCMWithNonceSize(block, encryptionNonceSize)
+}
+
+// messageSignature calculates HMAC-SHA256 of message fields: ID, task name, timestamp, ETA, timeout, content type,
+// content encoding, headers, body, chain and group. Timestamp and ETA are signed with seconds precision and timeout
+// with milliseconds precision, which are supported by all brokers. Retries are not signed, because broker requeue
+// and dead letter requeue change them without signing keys; worker signs retried and rate limited messages again,
+// because it changes their ETA
+func messageSignature(key []byte, cbMessage *CabbageMessage) []byte {
+	mac := hmac.New(sha256.New, key)
+	writeSignatureField(mac, signatureCanonicalPrefix)
+	writeSignatureField(mac, cbMessage.ID)
+	writeSignatureField(mac, cbMessage.TaskName)
+	writeSignatureField(mac, fmt.Sprint(cbMessage.Timestamp.Unix()))
+	eta := ""
+	if cbMessage.ETA != nil {
+		eta = fmt.Sprint(cbMessage.ETA.Unix())
+	}
+	writeSignatureField(mac, eta)
+	writeSignatureField(mac, fmt.Sprint(cbMessage.Timeout.Milliseconds()))
+	contentType := cbMessage.ContentType
+	if contentType == "" {
+		// RabbitMQ broker sends message without content type as json
+		contentType = ContentTypeJSON
+	}
+	writeSignatureField(mac, contentType)
+	writeSignatureField(mac, cbMessage.ContentEncoding)
+	keys := make([]string, 0, len(cbMessage.Headers))
+	for key := range cbMessage.Headers {
+		if key != SignatureHeader {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	writeSignatureField(mac, fmt.Sprint(len(keys)))
+	for _, key := range keys {
+		writeSignatureField(mac, key)
+		writeSignatureField(mac, cbMessage.Headers[key])
+	}
+	writeSignatureField(mac, string(cbMessage.Body))
+	// chain is signed, so next chain tasks of signed message cant be changed
+	for _, link := range cbMessage.Chain {
+		writeSignatureField(mac, link.ID)
+		writeSignatureField(mac, link.TaskName)
+		writeSignatureField(mac, link.QueueName)
+	}
+	if cbMessage.Group != nil {
+		writeSignatureField(mac, "cabbage-group")
+		writeSignatureField(mac, cbMessage.Group.GroupID)
+		writeSignatureField(mac, fmt.Sprint(cbMessage.Group.Index))
+	}
+	return mac.Sum(nil)
+}
+
+// writeSignatureField write length prefixed field, so different messages cant have same canonical form
+func writeSignatureField(h hash.Hash, field string) {
+	var size [binary.MaxVarintLen64]byte
+	h.Write(size[:binary.PutUvarint(size[:], uint64(len(field)))])
+	h.Write([]byte(field))
+}
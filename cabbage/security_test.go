@@ -0,0 +1,183 @@
+package cabbage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// newTestSecurityConfig create security config with signing and encryption keys
+func newTestSecurityConfig(t *testing.T, currentKeyID string) *SecurityConfig {
+	keys := map[string][]byte{
+		"2023": bytes.Repeat([]byte{1}, 32),
+		"2024": bytes.Repeat([]byte{2}, 32),
+	}
+	signingKeys, err := NewKeyring(currentKeyID, keys)
+	if err != nil {
+		t.Fatalf("cant create keyring, %v", err)
+	}
+	encryptionKeys, _ := NewKeyring(currentKeyID, keys)
+	security, err := NewSecurityConfig(signingKeys, encryptionKeys)
+	if err != nil {
+		t.Fatalf("cant create security config, %v", err)
+	}
+	return security
+}
+
+func TestSecuritySealAndOpen(t *testing.T) {
+	security := newTestSecurityConfig(t, "2023")
+	msg := newCabbageMessage(taskName, body)
+	msg.Headers = map[string]string{"tenant": "acme", SignatureHeader: "forged"}
+	if err := security.seal(msg); err != nil {
+		t.Fatalf("cant seal message, %v", err)
+	}
+	if bytes.Contains(msg.Body, body) || msg.Headers[EncryptionKeyIDHeader] != "2023" || msg.Headers[SignatureKeyIDHeader] != "2023" {
+		t.Fatalf("message must be encrypted and signed, %+v", msg)
+	}
+	// rotated keyring opens messages sealed with previous key
+	opened, err := newTestSecurityConfig(t, "2024").open(msg)
+	if err != nil {
+		t.Fatalf("cant open message, %v", err)
+	}
+	if !bytes.Equal(opened, body) {
+		t.Errorf("invalid opened body %s", opened)
+	}
+
+	tampered := *msg
+	tampered.TaskName = "otherTask"
+	if _, err := security.open(&tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered message must have invalid signature, got %v", err)
+	}
+	tampered = *msg
+	tampered.Chain = []ChainLink{{ID: "forged", TaskName: taskName, QueueName: "otherQueue"}}
+	if _, err := security.open(&tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("message with tampered chain must have invalid signature, got %v", err)
+	}
+	tampered = *msg
+	eta := time.Now().Add(time.Hour)
+	tampered.ETA = &eta
+	if _, err := security.open(&tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("message with tampered eta must have invalid signature, got %v", err)
+	}
+	tampered = *msg
+	tampered.Timeout = time.Hour
+	if _, err := security.open(&tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("message with tampered timeout must have invalid signature, got %v", err)
+	}
+	unsigned := newCabbageMessage(taskName, body)
+	if _, err := security.open(unsigned); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("unsigned message must be rejected, got %v", err)
+	}
+	if _, err := NewKeyring("missing", map[string][]byte{"2023": body}); err == nil {
+		t.Error("keyring without current key must not be created")
+	}
+	invalidKeys, _ := NewKeyring("short", map[string][]byte{"short": []byte("short")})
+	if _, err := NewSecurityConfig(nil, invalidKeys); err == nil {
+		t.Error("security config with invalid AES key must not be created")
+	}
+}
+
+func TestSecurityRabbitMQRoundTrip(t *testing.T) {
+	security := newTestSecurityConfig(t, "2024")
+	msg := newCabbageMessage(taskName, body)
+	if err := security.seal(msg); err != nil {
+		t.Fatalf("cant seal message, %v", err)
+	}
+	publishing := cabbageMessageToPublishing(msg)
+	// amqp timestamp has seconds precision
+	received := deliveryToCabbageMessage(amqp.Delivery{
+		Headers:     publishing.Headers,
+		Body:        publishing.Body,
+		ContentType: publishing.ContentType,
+		Timestamp:   publishing.Timestamp.Truncate(time.Second),
+	})
+	if _, err := security.open(received); err != nil {
+		t.Errorf("cant open message received from rabbitmq, %v", err)
+	}
+}
+
+func TestWorkerSecurity(t *testing.T) {
+	received := make(chan typedTestPayload, 1)
+	task, _ := NewTypedTask(taskName, queueName, func(ctx context.Context, payload typedTestPayload) error {
+		received <- payload
+		return nil
+	})
+	client, _ := startTestWorker(t, task)
+	client.SetCompression(GzipCompressor{}, 0)
+	client.SetSecurity(newTestSecurityConfig(t, "2024"))
+	if _, err := PublishTyped(client.publisher, taskName, typedTestPayload{OrderID: 42}); err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	select {
+	case payload := <-received:
+		if payload.OrderID != 42 {
+			t.Errorf("invalid payload %+v", payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("task was not proccessed")
+	}
+
+	// message injected directly to broker is not signed
+	client.broker.SendCabbageMessage(queueName, newCabbageMessage(taskName, []byte(`{"orderId":1}`)))
+	deadLetter := waitDeadLetter(t, client.broker.(*MemoryBroker))
+	if deadLetter.DeadLetter.Reason != DeadLetterReasonUnverified {
+		t.Errorf("invalid dead letter reason %s", deadLetter.DeadLetter.Reason)
+	}
+	if len(received) != 0 {
+		t.Error("unsigned message must not be proccessed")
+	}
+}
+
+func TestWorkerSecurityRetry(t *testing.T) {
+	service := &flakyTestService{failures: 1, attempts: make(chan int, 10)}
+	task := &Task{Name: taskName, QueueName: queueName, TProccesser: service, RetryPolicy: NewRetryPolicy(2, NewFixedBackoff(10*time.Millisecond))}
+	client, _ := startTestWorker(t, task)
+	client.SetSecurity(newTestSecurityConfig(t, "2024"))
+	if _, err := client.publisher.PublishTask(taskName, &testSchData{ID: "signed"}); err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	// retried message has new eta, so worker must sign it again
+	for expected := 1; expected <= 2; expected++ {
+		select {
+		case attempt := <-service.attempts:
+			if attempt != expected {
+				t.Fatalf("invalid attempt %d, must be %d", attempt, expected)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("attempt %d was not proccessed", expected)
+		}
+	}
+	if deadLetters, _ := client.DeadLetters(queueName, 0); len(deadLetters) != 0 {
+		t.Errorf("retried message must not be dead lettered, %+v", deadLetters[0].DeadLetter)
+	}
+}
+
+func TestWorkerForgedUnroutableMessage(t *testing.T) {
+	client := startTasksTestClient(t, &Task{Name: "shard", QueueName: queueName, TProccesser: &shardTestService{}})
+	client.SetSecurity(newTestSecurityConfig(t, "2024"))
+	client.resultBackend.SetTaskResult(&TaskResult{ID: "victim", TaskName: "shard", State: TaskStateSuccess})
+	client.groupBackend.CreateGroup(&GroupState{ID: "group", TaskIDs: []string{"victim", "other"}, GroupProgress: GroupProgress{Size: 2}})
+	forged := newCabbageMessage("unknownTask", body)
+	forged.ID = "victim"
+	forged.Chain = []ChainLink{{ID: "next", TaskName: "shard", QueueName: queueName}}
+	forged.Group = &GroupMember{GroupID: "group", Index: 0}
+	client.broker.SendCabbageMessage(queueName, forged)
+	deadLetter := waitDeadLetter(t, client.broker.(*MemoryBroker))
+	if deadLetter.DeadLetter.Reason != DeadLetterReasonUnverified {
+		t.Errorf("forged message must be dead lettered as unverified, got %s", deadLetter.DeadLetter.Reason)
+	}
+	// forged message must not change results, chain or group of other tasks
+	if victim, err := client.resultBackend.GetTaskResult("victim"); err != nil || victim.State != TaskStateSuccess {
+		t.Errorf("result of victim task must not be changed, got %+v, %v", victim, err)
+	}
+	if _, err := client.resultBackend.GetTaskResult("next"); !errors.Is(err, ErrResultNotFound) {
+		t.Errorf("result of next chain task must not be stored, got %v", err)
+	}
+	if group, err := client.groupBackend.GetGroup("group"); err != nil || group.Failed != 0 || group.Succeeded != 0 {
+		t.Errorf("group must not be changed, got %+v, %v", group, err)
+	}
+}
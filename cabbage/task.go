@@ -3,6 +3,8 @@ package cabbage
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 )
 
 // TaskProccesser interface for proccess consume message
@@ -21,6 +23,42 @@ type Task struct {
 	QueueName   string
 	TProccesser TaskProccesser
 	WithPublish bool
+	RetryPolicy *RetryPolicy
+	Timeout     time.Duration // soft timeout: task context is cancelled after timeout, 0 - no timeout
+	HardTimeout time.Duration // hard timeout: worker stops waiting for task after timeout, 0 - no timeout
+	Middlewares []Middleware  // task middlewares, called after worker middlewares
+	Codec       Codec         // payload codec of typed task, publisher codec if nil
+	UniqueTTL   time.Duration // dedup window: publishes of task with same body are dropped within window, 0 - not unique
+	RateLimit   string        // task runs limit shared by workers, like "100/minute", empty - no limit
+}
+
+// TaskTimeoutError returned by worker when task exceeded its timeout
+type TaskTimeoutError struct {
+	Timeout time.Duration
+	Hard    bool  // task did not return after hard timeout and was abandoned by worker
+	Err     error // task error, nil for hard timeout
+}
+
+func (e *TaskTimeoutError) Error() string {
+	if e.Hard {
+		return fmt.Sprintf("task hard timeout %s exceeded, task abandoned", e.Timeout)
+	}
+	return fmt.Sprintf("task timeout %s exceeded: %v", e.Timeout, e.Err)
+}
+
+// Unwrap returns task error
+func (e *TaskTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// TaskPanicError returned by worker when task proccesser panics
+type TaskPanicError struct {
+	Value interface{} // value passed to panic
+	Stack []byte      // stack trace of panicked goroutine
+}
+
+func (e *TaskPanicError) Error() string {
+	return fmt.Sprintf("task panic: %v\n%s", e.Value, e.Stack)
 }
 
 // NewTask construct cabbage Task
@@ -0,0 +1,133 @@
+package cabbage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// DecodeError returned by typed task when message body cant be decoded to task payload,
+// task with DecodeError is not retried
+type DecodeError struct {
+	TaskName string
+	Err      error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("cant decode task %s payload: %v", e.TaskName, e.Err)
+}
+
+// Unwrap returns codec error
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports that decode errors are permanent
+func (e *DecodeError) Retryable() bool {
+	return false
+}
+
+// nonRetryableError wraps error, which must not be retried
+type nonRetryableError struct {
+	err error
+}
+
+func (e *nonRetryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *nonRetryableError) Unwrap() error {
+	return e.err
+}
+
+func (e *nonRetryableError) Retryable() bool {
+	return false
+}
+
+// NonRetryable marks task error as permanent, task failed with such error is not retried
+// and moved to dead letter queue
+func NonRetryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &nonRetryableError{err: err}
+}
+
+// isRetryable checks that task error is not marked as permanent
+func isRetryable(err error) bool {
+	var retryable interface{ Retryable() bool }
+	if errors.As(err, &retryable) {
+		return retryable.Retryable()
+	}
+	return true
+}
+
+// typedTaskProccesser decodes message body to payload of type T and calls task function
+type typedTaskProccesser[T any] struct {
+	name  string
+	fn    func(ctx context.Context, payload T) error
+	codec Codec
+}
+
+// ProccessTask decode body with codec for message content type and call task function
+func (p *typedTaskProccesser[T]) ProccessTask(ctx context.Context, body []byte, ID string) error {
+	codec, err := messageCodec(CabbageMessageFromContext(ctx), p.codec)
+	if err != nil {
+		return &DecodeError{TaskName: p.name, Err: err}
+	}
+	var payload T
+	if err := codec.Unmarshal(body, &payload); err != nil {
+		return &DecodeError{TaskName: p.name, Err: err}
+	}
+	return p.fn(ctx, payload)
+}
+
+// NewTypedTask construct cabbage Task, which decodes message body to payload of type T with codec
+// for message content type. Payload is published with PublishTyped with publisher codec, JSONCodec by default
+func NewTypedTask[T any](name string, queueName string, fn func(ctx context.Context, payload T) error) (*Task, error) {
+	return newTypedTask(name, queueName, fn, nil)
+}
+
+// NewTypedTaskWithCodec construct cabbage Task, which payload is published with codec
+func NewTypedTaskWithCodec[T any](name string, queueName string, fn func(ctx context.Context, payload T) error, codec Codec) (*Task, error) {
+	if codec == nil {
+		return nil, errors.New("codec cant be nil")
+	}
+	return newTypedTask(name, queueName, fn, codec)
+}
+
+// newTypedTask construct typed task, messages without content type are decoded with codec or JSONCodec
+func newTypedTask[T any](name string, queueName string, fn func(ctx context.Context, payload T) error, codec Codec) (*Task, error) {
+	if fn == nil {
+		return nil, errors.New("task function cant be nil")
+	}
+	tp := &typedTaskProccesser[T]{name: name, fn: fn, codec: codec}
+	if codec == nil {
+		tp.codec = JSONCodec{}
+	}
+	task, err := NewTask(name, queueName, tp, true)
+	if err != nil {
+		return nil, err
+	}
+	task.Codec = codec
+	return task, nil
+}
+
+// typedPublisher encodes payload with codec
+type typedPublisher[T any] struct {
+	payload T
+	codec   Codec
+}
+
+// ToPublish encode payload
+func (p typedPublisher[T]) ToPublish() ([]byte, error) {
+	return p.codec.Marshal(p.payload)
+}
+
+// PublishTyped encode payload with task codec, if it is set, otherwise with publisher codec, and publish task.
+// Codec content type is stored in message
+func PublishTyped[T any](publisher *Publisher, taskName string, payload T, opts ...PublishOption) (*AsyncResult, error) {
+	codec := publisher.taskCodec(taskName)
+	opts = append([]PublishOption{ContentType(codec.ContentType())}, opts...)
+	return publisher.PublishTask(taskName, typedPublisher[T]{payload: payload, codec: codec}, opts...)
+}
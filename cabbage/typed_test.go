@@ -0,0 +1,69 @@
+package cabbage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type typedTestPayload struct {
+	OrderID int      `json:"orderId"`
+	Items   []string `json:"items"`
+}
+
+func TestTypedTask(t *testing.T) {
+	received := make(chan typedTestPayload, 1)
+	task, err := NewTypedTask(taskName, queueName, func(ctx context.Context, payload typedTestPayload) error {
+		received <- payload
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("cant create typed task, %v", err)
+	}
+	client, _ := startTestWorker(t, task)
+	if _, err := PublishTyped(client.publisher, taskName, typedTestPayload{OrderID: 42, Items: []string{"cabbage"}}); err != nil {
+		t.Fatalf("cant publish typed task, %v", err)
+	}
+	select {
+	case payload := <-received:
+		if payload.OrderID != 42 || len(payload.Items) != 1 || payload.Items[0] != "cabbage" {
+			t.Errorf("invalid payload %+v", payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("task was not proccessed")
+	}
+}
+
+func TestTypedTaskDecodeError(t *testing.T) {
+	attempts := make(chan struct{}, 10)
+	task, _ := NewTypedTask(taskName, queueName, func(ctx context.Context, payload typedTestPayload) error {
+		attempts <- struct{}{}
+		return nil
+	})
+	task.RetryPolicy = NewRetryPolicy(3, nil)
+	client, _ := startTestWorker(t, task)
+	if _, err := PublishTyped(client.publisher, taskName, map[string]string{"orderId": "not a number"}); err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	deadLetter := waitDeadLetter(t, client.broker.(*MemoryBroker))
+	if deadLetter.DeadLetter.Attempts != 1 {
+		t.Errorf("decode error must not be retried, attempts %d", deadLetter.DeadLetter.Attempts)
+	}
+	if len(attempts) != 0 {
+		t.Error("task function must not be called")
+	}
+}
+
+func TestNonRetryable(t *testing.T) {
+	errPermanent := errors.New("permanent")
+	if isRetryable(NonRetryable(errPermanent)) || !errors.Is(NonRetryable(errPermanent), errPermanent) {
+		t.Error("NonRetryable error must not be retryable and must wrap error")
+	}
+	if isRetryable(&TaskTimeoutError{Err: &DecodeError{Err: errPermanent}}) {
+		t.Error("wrapped DecodeError must not be retryable")
+	}
+	if !isRetryable(errPermanent) || NonRetryable(nil) != nil {
+		t.Error("plain error must be retryable")
+	}
+}
@@ -0,0 +1,144 @@
+package cabbage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrNoDedupStore returned when unique task is published without dedup store
+var ErrNoDedupStore = errors.New("dedup store is not set")
+
+// DuplicateTaskError returned by PublishTask when unique task with same dedup key was published within dedup window,
+// duplicate message is not published
+type DuplicateTaskError struct {
+	Key        string
+	ExistingID string // ID of published task message with same dedup key
+}
+
+func (e *DuplicateTaskError) Error() string {
+	return fmt.Sprintf("duplicate task: key %s, existing task %s", e.Key, e.ExistingID)
+}
+
+// DedupStore is interface for dedup keys of unique tasks storage, store must be shared by publishers.
+// Acquire must be atomic, so only one of concurrent publishers acquires key
+type DedupStore interface {
+	// Acquire store task ID under key for ttl if key is absent, returns task ID stored under key and acquired flag
+	Acquire(key, ID string, ttl time.Duration) (existingID string, acquired bool, err error)
+	// Release remove key, if it is stored with task ID
+	Release(key, ID string) error
+}
+
+// Unique publish task as unique within ttl: duplicate publishes of task with same body are dropped,
+// overrides task UniqueTTL
+func Unique(ttl time.Duration) PublishOption {
+	return func(o *publishOptions) {
+		o.uniqueTTL = ttl
+	}
+}
+
+// UniqueKey publish task as unique within ttl with explicit dedup key: duplicate publishes with same key are dropped
+func UniqueKey(key string, ttl time.Duration) PublishOption {
+	return func(o *publishOptions) {
+		o.uniqueKey = key
+		o.uniqueTTL = ttl
+	}
+}
+
+// uniqueKey returns dedup key and window of published task, key is derived from task name and body hash
+// if it is not set explicitly, zero window - task is not unique. Window shorter than 1ms is rounded up to 1ms
+func uniqueKey(task *Task, body []byte, o *publishOptions) (string, time.Duration) {
+	ttl := task.UniqueTTL
+	if o.uniqueTTL > 0 {
+		ttl = o.uniqueTTL
+	}
+	if ttl <= 0 {
+		return "", 0
+	}
+	// redis dedup store stores keys with milliseconds ttl
+	if ttl < time.Millisecond {
+		ttl = time.Millisecond
+	}
+	if o.uniqueKey != "" {
+		return o.uniqueKey, ttl
+	}
+	hash := sha256.Sum256(body)
+	return task.Name + ":" + hex.EncodeToString(hash[:]), ttl
+}
+
+// acquireUnique acquire dedup key for task message, returns DuplicateTaskError if key is acquired by other message
+func (p *Publisher) acquireUnique(key string, ttl time.Duration, cbMessage *CabbageMessage) error {
+	p.taskLock.RLock()
+	store := p.dedupStore
+	p.taskLock.RUnlock()
+	if store == nil {
+		return ErrNoDedupStore
+	}
+	existingID, acquired, err := store.Acquire(key, cbMessage.ID, ttl)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return &DuplicateTaskError{Key: key, ExistingID: existingID}
+	}
+	return nil
+}
+
+// releaseUnique release dedup key of not published task message, so task can be published again
+func (p *Publisher) releaseUnique(key string, cbMessage *CabbageMessage) {
+	p.taskLock.RLock()
+	store := p.dedupStore
+	p.taskLock.RUnlock()
+	if err := store.Release(key, cbMessage.ID); err != nil {
+		log.Printf("[!] cant release dedup key %s of task %s: %+v", key, cbMessage.ID, err)
+	}
+}
+
+// memoryDedupKey dedup key stored in MemoryDedupStore
+type memoryDedupKey struct {
+	ID        string
+	expiresAt time.Time
+}
+
+// MemoryDedupStore is in-memory DedupStore for tests and single-process deployments
+type MemoryDedupStore struct {
+	lock sync.Mutex
+	keys map[string]memoryDedupKey
+}
+
+// NewMemoryDedupStore create MemoryDedupStore
+func NewMemoryDedupStore() *MemoryDedupStore {
+	return &MemoryDedupStore{keys: make(map[string]memoryDedupKey)}
+}
+
+// Acquire store task ID under key for ttl if key is absent or expired
+func (s *MemoryDedupStore) Acquire(key, ID string, ttl time.Duration) (string, bool, error) {
+	now := time.Now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// expired keys are removed on write, so store does not grow
+	for storedKey, stored := range s.keys {
+		if !stored.expiresAt.After(now) {
+			delete(s.keys, storedKey)
+		}
+	}
+	if stored, ok := s.keys[key]; ok {
+		return stored.ID, false, nil
+	}
+	s.keys[key] = memoryDedupKey{ID: ID, expiresAt: now.Add(ttl)}
+	return ID, true, nil
+}
+
+// Release remove key, if it is stored with task ID
+func (s *MemoryDedupStore) Release(key, ID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if stored, ok := s.keys[key]; ok && stored.ID == ID {
+		delete(s.keys, key)
+	}
+	return nil
+}
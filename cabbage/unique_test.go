@@ -0,0 +1,122 @@
+package cabbage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUniqueTask(t *testing.T) {
+	publisher := newPublisher(NewMemoryBroker())
+	publisher.SetDedupStore(NewMemoryDedupStore())
+	publisher.RegisterTask(&Task{Name: taskName, QueueName: queueName, WithPublish: true, UniqueTTL: time.Minute})
+	first, err := publisher.PublishTask(taskName, &testSchData{ID: "unique"})
+	if err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	_, err = publisher.PublishTask(taskName, &testSchData{ID: "unique"})
+	var duplicateErr *DuplicateTaskError
+	if !errors.As(err, &duplicateErr) || duplicateErr.ExistingID != first.ID {
+		t.Fatalf("duplicate task must not be published, got %v", err)
+	}
+	if _, err := publisher.PublishTask(taskName, &testSchData{ID: "other"}); err != nil {
+		t.Errorf("task with other body must be published, got %v", err)
+	}
+	if _, err := publisher.PublishTask(taskName, &testSchData{ID: "unique"}, Unique(0)); err == nil {
+		t.Error("task unique window must not be disabled by zero option")
+	}
+}
+
+func TestUniqueKey(t *testing.T) {
+	publisher := newTestPublisher(NewMemoryBroker())
+	publisher.SetDedupStore(NewMemoryDedupStore())
+	if _, err := publisher.PublishTask(taskName, &testSchData{ID: "1"}); err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	if _, err := publisher.PublishTask(taskName, &testSchData{ID: "1"}); err != nil {
+		t.Errorf("not unique task must be published, got %v", err)
+	}
+	first, err := publisher.PublishTask(taskName, &testSchData{ID: "1"}, UniqueKey("report", time.Minute))
+	if err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	_, err = publisher.PublishTask(taskName, &testSchData{ID: "2"}, UniqueKey("report", time.Minute))
+	var duplicateErr *DuplicateTaskError
+	if !errors.As(err, &duplicateErr) || duplicateErr.Key != "report" || duplicateErr.ExistingID != first.ID {
+		t.Errorf("task with same dedup key must not be published, got %v", err)
+	}
+}
+
+func TestUniqueShortWindow(t *testing.T) {
+	task := &Task{Name: taskName, UniqueTTL: time.Nanosecond}
+	if _, ttl := uniqueKey(task, body, &publishOptions{}); ttl != time.Millisecond {
+		t.Errorf("window shorter than 1ms must be rounded up, got %s", ttl)
+	}
+	if _, ttl := uniqueKey(task, body, &publishOptions{uniqueTTL: time.Microsecond}); ttl != time.Millisecond {
+		t.Errorf("option window shorter than 1ms must be rounded up, got %s", ttl)
+	}
+}
+
+func TestUniqueTaskPublishFailure(t *testing.T) {
+	publisher := newTestPublisher(NewMemoryBroker())
+	publisher.SetDedupStore(NewMemoryDedupStore())
+	failing := true
+	publisher.Use(func(next PublishHandler) PublishHandler {
+		return func(queueName string, cbMessage *CabbageMessage) error {
+			if failing {
+				return errors.New("publish error")
+			}
+			return next(queueName, cbMessage)
+		}
+	})
+	if _, err := publisher.PublishTask(taskName, &testSchData{}, Unique(time.Minute)); err == nil {
+		t.Fatal("expected publish error")
+	}
+	failing = false
+	if _, err := publisher.PublishTask(taskName, &testSchData{}, Unique(time.Minute)); err != nil {
+		t.Errorf("dedup key of not published task must be released, got %v", err)
+	}
+}
+
+func TestUniqueTaskWithoutStore(t *testing.T) {
+	publisher := newTestPublisher(NewMemoryBroker())
+	if _, err := publisher.PublishTask(taskName, &testSchData{}, Unique(time.Minute)); err != ErrNoDedupStore {
+		t.Errorf("expected ErrNoDedupStore, got %v", err)
+	}
+}
+
+func TestMemoryDedupStore(t *testing.T) {
+	store := NewMemoryDedupStore()
+	testDedupStore(t, store)
+	store.Acquire("expired", "a", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, acquired, err := store.Acquire("expired", "b", time.Minute); err != nil || !acquired {
+		t.Errorf("expired key must be acquired, got %v, %v", acquired, err)
+	}
+}
+
+// testDedupStore checks that dedup key is acquired once and released only by its task
+func testDedupStore(t *testing.T, store DedupStore) {
+	key := newCabbageMessage(taskName, nil).ID
+	if existingID, acquired, err := store.Acquire(key, "a", time.Minute); err != nil || !acquired || existingID != "a" {
+		t.Fatalf("key must be acquired, got %s, %v, %v", existingID, acquired, err)
+	}
+	if existingID, acquired, err := store.Acquire(key, "b", time.Minute); err != nil || acquired || existingID != "a" {
+		t.Errorf("acquired key must not be acquired again, got %s, %v, %v", existingID, acquired, err)
+	}
+	if err := store.Release(key, "b"); err != nil {
+		t.Fatalf("cant release key, %v", err)
+	}
+	if _, acquired, _ := store.Acquire(key, "b", time.Minute); acquired {
+		t.Error("key must not be released by other task")
+	}
+	if err := store.Release(key, "a"); err != nil {
+		t.Fatalf("cant release key, %v", err)
+	}
+	if _, acquired, err := store.Acquire(key, "b", time.Minute); err != nil || !acquired {
+		t.Errorf("released key must be acquired, got %v, %v", acquired, err)
+	}
+	if _, acquired, err := store.Acquire(key+":short", "a", time.Microsecond); err != nil || !acquired {
+		t.Errorf("key with ttl shorter than 1ms must be acquired, got %v, %v", acquired, err)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,20 +16,38 @@ type CabbageWorker struct {
 	broker                   CabbageBroker
 	numWorkers               int
 	registeredTaskProcessers *TaskProccessersRoutes
+	registeredTasks          map[string]*Task
 	taskLock                 sync.RWMutex
 	cancel                   context.CancelFunc
 	workWG                   sync.WaitGroup
-	rateLimitPeriod          time.Duration
+	rateLimitPeriod          time.Duration // minimal period between messages for each worker goroutine, 0 - no limit
+	pollPeriod               time.Duration // polling period for brokers without blocking receive
 	queueName                string
+	resultBackend            ResultBackend
+	middlewares              []Middleware
+	security                 *SecurityConfig
+	groupBackend             GroupBackend
+	revokeStore              RevokeStore
+	idempotencyStore         IdempotencyStore
+	rateLimiter              RateLimiter        // shared limiter of tasks rate limits
+	localRateLimiter         *MemoryRateLimiter // limiter of tasks rate limits without shared limiter or if it fails
+	revokeCheckPeriod        time.Duration      // period of revocation checks of running tasks
+	runningTasks             map[*runningTask]string
+	runningLock              sync.Mutex
+	abandonedTasks           atomic.Int64 // tasks abandoned after hard timeout
 }
 
 // newCabbageWorker construct CabbageWorker
 func newCabbageWorker(broker CabbageBroker, numWorkers int, queueName string) *CabbageWorker {
 	worker := &CabbageWorker{
-		broker:          broker,
-		numWorkers:      numWorkers,
-		rateLimitPeriod: 100 * time.Millisecond,
-		queueName:       queueName,
+		broker:            broker,
+		numWorkers:        numWorkers,
+		pollPeriod:        100 * time.Millisecond,
+		revokeCheckPeriod: 500 * time.Millisecond,
+		queueName:         queueName,
+		registeredTasks:   make(map[string]*Task),
+		runningTasks:      make(map[*runningTask]string),
+		localRateLimiter:  NewMemoryRateLimiter(),
 	}
 	return worker
 }
@@ -52,6 +72,70 @@ func (w *CabbageWorker) RegisterTaskProcesser(name string, tproccesser TaskProcc
 	w.taskLock.Unlock()
 }
 
+// RegisterTask register task proccesser with task options
+func (w *CabbageWorker) RegisterTask(task *Task) {
+	w.RegisterTaskProcesser(task.Name, task.TProccesser)
+	w.taskLock.Lock()
+	w.registeredTasks[task.Name] = task
+	w.taskLock.Unlock()
+}
+
+// Use add middlewares, which wrap every task proccesser of worker, must be called before worker start.
+// Worker middlewares are called before task middlewares
+func (w *CabbageWorker) Use(middlewares ...Middleware) {
+	w.taskLock.Lock()
+	w.middlewares = append(w.middlewares, middlewares...)
+	w.taskLock.Unlock()
+}
+
+// SetResultBackend set backend for storing task results, must be called before worker start
+func (w *CabbageWorker) SetResultBackend(backend ResultBackend) {
+	w.resultBackend = backend
+}
+
+// SetGroupBackend set backend for storing groups state, must be called before worker start
+func (w *CabbageWorker) SetGroupBackend(backend GroupBackend) {
+	w.groupBackend = backend
+}
+
+// SetSecurity set message signing and encryption settings, must be called before worker start
+func (w *CabbageWorker) SetSecurity(security *SecurityConfig) {
+	w.security = security
+}
+
+// SetRateLimitPeriod set minimal period between messages for each worker goroutine, 0 disables rate limit
+func (w *CabbageWorker) SetRateLimitPeriod(period time.Duration) {
+	w.rateLimitPeriod = period
+}
+
+// SetRevokeStore set revoke store, revoked tasks are skipped and running tasks revoked with terminate are cancelled,
+// must be called before worker start
+func (w *CabbageWorker) SetRevokeStore(store RevokeStore) {
+	w.revokeStore = store
+}
+
+// SetIdempotencyStore set store of processed task messages: successfully processed message is not proccessed again,
+// when it is redelivered, must be called before worker start
+func (w *CabbageWorker) SetIdempotencyStore(store IdempotencyStore) {
+	w.idempotencyStore = store
+}
+
+// SetRateLimiter set limiter of tasks rate limits shared by workers, tasks are limited only in worker process
+// without shared limiter, must be called before worker start
+func (w *CabbageWorker) SetRateLimiter(limiter RateLimiter) {
+	w.rateLimiter = limiter
+}
+
+// SetRevokeCheckPeriod set period of revocation checks of running tasks, must be called before worker start
+func (w *CabbageWorker) SetRevokeCheckPeriod(period time.Duration) {
+	w.revokeCheckPeriod = period
+}
+
+// SetPollPeriod set polling period for brokers without blocking receive
+func (w *CabbageWorker) SetPollPeriod(period time.Duration) {
+	w.pollPeriod = period
+}
+
 // StartWorkerWithContext start cabbage worker with context
 func (w *CabbageWorker) StartWorkerWithContext(ctx context.Context) error {
 	if w.registeredTaskProcessers == nil {
@@ -59,43 +143,217 @@ func (w *CabbageWorker) StartWorkerWithContext(ctx context.Context) error {
 	}
 	var wctx context.Context
 	wctx, w.cancel = context.WithCancel(ctx)
+	if w.revokeStore != nil && w.revokeCheckPeriod > 0 {
+		w.workWG.Add(1)
+		go w.watchRevocations(wctx)
+	}
 	w.workWG.Add(w.numWorkers)
 	for i := 0; i < w.numWorkers; i++ {
 		go func(workerID int) {
 			log.Printf("[*] Start Cabbage Worker for Queue: %s, ID: %d \n", w.queueName, workerID)
 			defer w.workWG.Done()
-			ticker := time.NewTicker(w.rateLimitPeriod)
 			for {
-				select {
-				case <-wctx.Done():
+				cbMessage := w.receiveMessage(wctx)
+				if wctx.Err() != nil {
+					if cbMessage != nil {
+						// message received during stop is returned to queue, so it is not lost
+						w.nackTask(cbMessage)
+					}
 					log.Printf("[*] Finish Cabbage Worker for Queue: %s, ID: %d \n", w.queueName, workerID)
 					return
-				case <-ticker.C:
-					// get task
-					cbMessage, err := w.broker.GetCabbageMessage(w.queueName)
-					if err != nil || cbMessage == nil {
-						continue
-					}
-					// get task proccesser
-					log.Printf("[*] Queue: %s, worker: %d, GET message\n", w.queueName, workerID)
-					tp, err := w.getTaskProcesser(cbMessage.TaskName)
-					if err != nil {
-						log.Printf("[!] Queue: %s, worker: %d, cant get task proccesser for taskName %s, id %s: %+v", w.queueName, workerID, cbMessage.TaskName, cbMessage.ID, err)
-						continue
-					}
-					// process task request
-					err = w.runTask(ctx, tp, cbMessage)
-					if err != nil {
-						log.Printf("[!] Queue: %s, worker: %d,failed to run task message %s: %+v", w.queueName, workerID, cbMessage.ID, err)
-						continue
-					}
 				}
+				if cbMessage == nil {
+					continue
+				}
+				log.Printf("[*] Queue: %s, worker: %d, GET message\n", w.queueName, workerID)
+				w.proccessMessage(ctx, workerID, cbMessage)
+				sleepWithContext(wctx, w.rateLimitPeriod)
 			}
 		}(i)
 	}
 	return nil
 }
 
+// receiveMessage get message from broker, waits for message if broker supports blocking receive,
+// otherwise polls broker with poll period
+func (w *CabbageWorker) receiveMessage(ctx context.Context) *CabbageMessage {
+	var cbMessage *CabbageMessage
+	var err error
+	if blockingBroker, ok := w.broker.(BlockingCabbageBroker); ok {
+		cbMessage, err = blockingBroker.GetCabbageMessageWithContext(ctx, w.queueName)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("[!] Queue: %s, cant get message: %+v", w.queueName, err)
+		}
+	} else {
+		cbMessage, err = w.broker.GetCabbageMessage(w.queueName)
+	}
+	if err != nil || cbMessage == nil {
+		sleepWithContext(ctx, w.pollPeriod)
+		return nil
+	}
+	return cbMessage
+}
+
+// sleepWithContext sleeps for duration or until context is done
+func sleepWithContext(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// proccessMessage run task for received message, stores task result and acknowledges message to broker
+func (w *CabbageWorker) proccessMessage(ctx context.Context, workerID int, cbMessage *CabbageMessage) {
+	// message is verified before task proccesser is found, so forged message cant store result of other task
+	taskMessage, err := w.openMessage(cbMessage)
+	if err != nil {
+		log.Printf("[!] Queue: %s, worker: %d, cant open task message %s: %+v", w.queueName, workerID, cbMessage.ID, err)
+		reason := DeadLetterReasonMalformed
+		if errors.Is(err, ErrInvalidSignature) {
+			reason = DeadLetterReasonUnverified
+		} else {
+			// result of message with invalid signature is not stored, so forged message cant overwrite it
+			taskResult := newTaskResult(cbMessage, TaskStateFailure)
+			taskResult.Error = err.Error()
+			w.setTaskResult(taskResult)
+			w.stopTask(cbMessage, err)
+		}
+		w.deadLetterTask(cbMessage, reason, err)
+		return
+	}
+	// get task proccesser
+	tp, err := w.getTaskProcesser(cbMessage.TaskName)
+	if err != nil {
+		log.Printf("[!] Queue: %s, worker: %d, cant get task proccesser for taskName %s, id %s: %+v", w.queueName, workerID, cbMessage.TaskName, cbMessage.ID, err)
+		taskResult := newTaskResult(cbMessage, TaskStateFailure)
+		taskResult.Error = err.Error()
+		w.setTaskResult(taskResult)
+		w.stopTask(cbMessage, err)
+		w.deadLetterTask(cbMessage, DeadLetterReasonUnroutable, err)
+		return
+	}
+	if w.isProcessed(cbMessage) {
+		// result of processed task is already stored, so redelivered message is only acknowledged
+		log.Printf("[*] Queue: %s, worker: %d, skip processed task message %s\n", w.queueName, workerID, cbMessage.ID)
+		w.ackTask(cbMessage)
+		return
+	}
+	if w.isRevoked(cbMessage) {
+		w.revokeTask(cbMessage, newTaskResult(cbMessage, TaskStateRevoked))
+		return
+	}
+	if result, ok := w.succeededGroupTaskResult(cbMessage); ok {
+		// task is retried only to publish chord callback, so task is not run again
+		log.Printf("[*] Queue: %s, worker: %d, group task message %s is already succeeded\n", w.queueName, workerID, cbMessage.ID)
+		w.completeTask(workerID, cbMessage, result)
+		return
+	}
+	if delay := w.throttleDelay(cbMessage); delay > 0 {
+		w.throttleTask(cbMessage, delay)
+		return
+	}
+	taskResult := newTaskResult(cbMessage, TaskStateStarted)
+	startedAt := time.Now()
+	taskResult.StartedAt = &startedAt
+	w.setTaskResult(taskResult)
+	// process task request, received message is kept for retry and dead letter queue
+	runCtx, running, finishRunning := w.startRunningTask(ctx, cbMessage.ID)
+	result, err := w.runTask(runCtx, tp, taskMessage)
+	finishRunning()
+	finishedAt := time.Now()
+	taskResult.FinishedAt = &finishedAt
+	if err != nil && running.revoked.Load() {
+		log.Printf("[!] Queue: %s, worker: %d, task message %s is terminated: %+v", w.queueName, workerID, cbMessage.ID, err)
+		w.revokeTask(cbMessage, taskResult)
+		return
+	}
+	if err != nil {
+		log.Printf("[!] Queue: %s, worker: %d,failed to run task message %s: %+v", w.queueName, workerID, cbMessage.ID, err)
+		taskResult.Error = err.Error()
+		if w.shouldRetry(cbMessage, err) {
+			taskResult.State = TaskStateRetry
+			w.setTaskResult(taskResult)
+			w.retryTask(cbMessage)
+		} else {
+			taskResult.State = TaskStateFailure
+			w.setTaskResult(taskResult)
+			w.stopTask(cbMessage, err)
+			w.deadLetterTask(cbMessage, deadLetterReason(err), err)
+		}
+		return
+	}
+	taskResult.State = TaskStateSuccess
+	taskResult.Result = result
+	w.setTaskResult(taskResult)
+	w.completeTask(workerID, cbMessage, result)
+}
+
+// completeTask complete group and publish next chain task of succeeded task and acknowledges message
+func (w *CabbageWorker) completeTask(workerID int, cbMessage *CabbageMessage, result []byte) {
+	// message is acknowledged only after chord callback is published
+	if err := w.completeGroupTask(cbMessage, result, nil); err != nil {
+		w.retryTask(cbMessage)
+		return
+	}
+	if len(cbMessage.Chain) > 0 {
+		// message is acknowledged only after next chain task is published
+		if err := w.publishNextChainTask(cbMessage, result); err != nil {
+			log.Printf("[!] Queue: %s, worker: %d, cant publish next chain task of message %s: %+v", w.queueName, workerID, cbMessage.ID, err)
+			w.nackTask(cbMessage)
+			return
+		}
+	}
+	// message is marked after next chain task is published, so redelivered message continues chain
+	w.markProcessed(cbMessage)
+	w.ackTask(cbMessage)
+}
+
+// stopTask stop chain and complete group task of failed task
+func (w *CabbageWorker) stopTask(cbMessage *CabbageMessage, err error) {
+	stopChain(cbMessage, err, w.setTaskResult)
+	w.completeGroupTask(cbMessage, nil, err)
+}
+
+// publishNextChainTask publish next chain task with task result as body
+func (w *CabbageWorker) publishNextChainTask(cbMessage *CabbageMessage, result []byte) error {
+	next := newChainLinkMessage(cbMessage, result)
+	if err := w.security.seal(next); err != nil {
+		return err
+	}
+	return w.broker.SendCabbageMessage(cbMessage.Chain[0].QueueName, next)
+}
+
+// openMessage returns copy of received message with verified, decrypted and decompressed body for task proccesser
+func (w *CabbageWorker) openMessage(cbMessage *CabbageMessage) (*CabbageMessage, error) {
+	body, err := w.security.open(cbMessage)
+	if err != nil {
+		return nil, err
+	}
+	taskMessage := *cbMessage
+	taskMessage.Body = body
+	if body, err = decompressBody(&taskMessage); err != nil {
+		return nil, err
+	}
+	taskMessage.Body = body
+	taskMessage.ContentEncoding = ""
+	return &taskMessage, nil
+}
+
+// setTaskResult store task result in result backend, if it is set
+func (w *CabbageWorker) setTaskResult(taskResult *TaskResult) {
+	if w.resultBackend == nil {
+		return
+	}
+	if err := w.resultBackend.SetTaskResult(taskResult); err != nil {
+		log.Printf("[!] Queue: %s, cant store task %s result: %+v", w.queueName, taskResult.ID, err)
+	}
+}
+
 // StartWorker start cabbage worker
 func (w *CabbageWorker) StartWorker() error {
 	return w.StartWorkerWithContext(context.Background())
@@ -113,10 +371,173 @@ func (w *CabbageWorker) getTaskProcesser(taskName string) (TaskProccesser, error
 	return task, nil
 }
 
-// runTask run task from task proccesser interface
-func (w *CabbageWorker) runTask(ctx context.Context, tp TaskProccesser, cbMessage *CabbageMessage) error {
-	err := tp.ProccessTask(ctx, cbMessage.Body, cbMessage.ID)
-	return err
+// getTask get registered task, returns nil if task registered only with proccesser
+func (w *CabbageWorker) getTask(taskName string) *Task {
+	w.taskLock.RLock()
+	defer w.taskLock.RUnlock()
+	return w.registeredTasks[taskName]
+}
+
+// runTask run task from task proccesser interface with middlewares and task timeouts, result is returned for TaskResultProccesser
+func (w *CabbageWorker) runTask(ctx context.Context, tp TaskProccesser, cbMessage *CabbageMessage) ([]byte, error) {
+	ctx = context.WithValue(ctx, taskInfoContextKey, newTaskInfo(cbMessage, w.queueName, w.getTask(cbMessage.TaskName)))
+	ctx = context.WithValue(ctx, messageContextKey, cbMessage)
+	middlewares := w.taskMiddlewares(cbMessage.TaskName)
+	timeout, hardTimeout := w.taskTimeouts(cbMessage)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var result []byte
+	var err error
+	if hardTimeout > 0 {
+		result, err = w.callTaskWithHardTimeout(ctx, tp, middlewares, cbMessage, hardTimeout)
+	} else {
+		result, err = callTask(ctx, tp, middlewares, cbMessage)
+	}
+	var timeoutErr *TaskTimeoutError
+	if err != nil && timeout > 0 && ctx.Err() == context.DeadlineExceeded && !errors.As(err, &timeoutErr) {
+		return nil, &TaskTimeoutError{Timeout: timeout, Err: err}
+	}
+	return result, err
+}
+
+// callTask call task proccesser wrapped with middlewares, panic is recovered and returned as TaskPanicError
+func callTask(ctx context.Context, tp TaskProccesser, middlewares []Middleware, cbMessage *CabbageMessage) (result []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, &TaskPanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	// result of TaskResultProccesser is passed around middlewares, which work with TaskProccesser
+	handler := TaskProccesserFunc(func(ctx context.Context, body []byte, ID string) error {
+		rp, ok := tp.(TaskResultProccesser)
+		if !ok {
+			return tp.ProccessTask(ctx, body, ID)
+		}
+		var err error
+		result, err = rp.ProccessTaskWithResult(ctx, body, ID)
+		return err
+	})
+	if err := chainMiddlewares(handler, middlewares).ProccessTask(ctx, cbMessage.Body, cbMessage.ID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// taskMiddlewares returns worker and task middlewares for task
+func (w *CabbageWorker) taskMiddlewares(taskName string) []Middleware {
+	w.taskLock.RLock()
+	defer w.taskLock.RUnlock()
+	middlewares := append([]Middleware(nil), w.middlewares...)
+	if task, ok := w.registeredTasks[taskName]; ok {
+		middlewares = append(middlewares, task.Middlewares...)
+	}
+	return middlewares
+}
+
+// taskOutput result of task proccesser call
+type taskOutput struct {
+	result []byte
+	err    error
+}
+
+// callTaskWithHardTimeout call task proccesser in separate goroutine, if task does not return
+// after hard timeout, worker stops waiting for it and task goroutine is abandoned
+func (w *CabbageWorker) callTaskWithHardTimeout(ctx context.Context, tp TaskProccesser, middlewares []Middleware, cbMessage *CabbageMessage, hardTimeout time.Duration) ([]byte, error) {
+	// context of abandoned task is cancelled, so task, which respects context late, stops
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan taskOutput, 1)
+	go func() {
+		result, err := callTask(ctx, tp, middlewares, cbMessage)
+		done <- taskOutput{result: result, err: err}
+	}()
+	timer := time.NewTimer(hardTimeout)
+	defer timer.Stop()
+	select {
+	case out := <-done:
+		return out.result, out.err
+	case <-timer.C:
+		abandoned := w.abandonedTasks.Add(1)
+		log.Printf("[!] Queue: %s, task %s, id %s exceeded hard timeout %s and was abandoned, abandoned tasks: %d", w.queueName, cbMessage.TaskName, cbMessage.ID, hardTimeout, abandoned)
+		return nil, &TaskTimeoutError{Timeout: hardTimeout, Hard: true}
+	}
+}
+
+// taskTimeouts returns soft and hard timeouts for message, message timeout overrides task soft timeout
+func (w *CabbageWorker) taskTimeouts(cbMessage *CabbageMessage) (time.Duration, time.Duration) {
+	var timeout, hardTimeout time.Duration
+	if task := w.getTask(cbMessage.TaskName); task != nil {
+		timeout, hardTimeout = task.Timeout, task.HardTimeout
+	}
+	if cbMessage.Timeout > 0 {
+		timeout = cbMessage.Timeout
+	}
+	return timeout, hardTimeout
+}
+
+// AbandonedTasks returns number of tasks abandoned by worker after hard timeout
+func (w *CabbageWorker) AbandonedTasks() int64 {
+	return w.abandonedTasks.Load()
+}
+
+// shouldRetry checks that task error is retryable and task retry policy allows retry of failed message
+func (w *CabbageWorker) shouldRetry(cbMessage *CabbageMessage, err error) bool {
+	task := w.getTask(cbMessage.TaskName)
+	return task != nil && isRetryable(err) && task.RetryPolicy.shouldRetry(cbMessage.Retries+1)
+}
+
+// retryTask re-publish failed message to worker queue with task retry policy backoff delay ETA
+func (w *CabbageWorker) retryTask(cbMessage *CabbageMessage) {
+	task := w.getTask(cbMessage.TaskName)
+	retryMessage := newRetryMessage(cbMessage)
+	delay := task.RetryPolicy.delay(retryMessage.Retries)
+	if delay > 0 {
+		eta := time.Now().Add(delay)
+		retryMessage.ETA = &eta
+	}
+	w.security.resign(retryMessage)
+	log.Printf("[*] Queue: %s, retry task %s, id %s, attempt %d in %s\n", w.queueName, cbMessage.TaskName, cbMessage.ID, retryMessage.Retries+1, delay)
+	// original message is acknowledged only after retry message is published
+	if err := w.broker.SendCabbageMessage(w.queueName, retryMessage); err != nil {
+		log.Printf("[!] Queue: %s, cant retry task message %s: %+v", w.queueName, cbMessage.ID, err)
+		w.nackTask(cbMessage)
+		return
+	}
+	w.ackTask(cbMessage)
+}
+
+// deadLetterTask send message to worker queue dead letter queue and acknowledges it,
+// if broker does not support dead letters or sending failed, message is rejected without requeue
+func (w *CabbageWorker) deadLetterTask(cbMessage *CabbageMessage, reason string, taskErr error) {
+	dlBroker, ok := w.broker.(DeadLetterBroker)
+	if ok {
+		err := dlBroker.SendDeadLetter(w.queueName, newDeadLetterMessage(cbMessage, reason, taskErr))
+		if err == nil {
+			w.ackTask(cbMessage)
+			return
+		}
+		log.Printf("[!] Queue: %s, cant send task message %s to dead letter queue: %+v", w.queueName, cbMessage.ID, err)
+	}
+	if err := w.broker.RejectCabbageMessage(w.queueName, cbMessage, false); err != nil {
+		log.Printf("[!] Queue: %s, cant reject task message %s: %+v", w.queueName, cbMessage.ID, err)
+	}
+}
+
+// ackTask acknowledges proccessed message
+func (w *CabbageWorker) ackTask(cbMessage *CabbageMessage) {
+	if err := w.broker.AckCabbageMessage(w.queueName, cbMessage); err != nil {
+		log.Printf("[!] Queue: %s, cant ack task message %s: %+v", w.queueName, cbMessage.ID, err)
+	}
+}
+
+// nackTask returns message to queue for redelivery
+func (w *CabbageWorker) nackTask(cbMessage *CabbageMessage) {
+	if err := w.broker.NackCabbageMessage(w.queueName, cbMessage, true); err != nil {
+		log.Printf("[!] Queue: %s, cant nack task message %s: %+v", w.queueName, cbMessage.ID, err)
+	}
 }
 
 // StopWorker stops cabbage workers
@@ -0,0 +1,458 @@
+package cabbage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type flakyTestService struct {
+	failures int
+	attempts chan int
+}
+
+func (s *flakyTestService) ProccessTask(ctx context.Context, body []byte, ID string) error {
+	attempt := TaskAttemptFromContext(ctx)
+	s.attempts <- attempt
+	if attempt <= s.failures {
+		return errors.New("flaky error")
+	}
+	return nil
+}
+
+// startTestWorker create client with memory broker and started worker with registered task
+func startTestWorker(t *testing.T, task *Task) (*CabbageClient, *CabbageWorker) {
+	client := NewCabbageClient(NewMemoryBroker())
+	worker, err := client.CreateWorker(task.QueueName, 1)
+	if err != nil {
+		t.Fatalf("cant create worker, %v", err)
+	}
+	client.CreatePublisher()
+	task.WithPublish = true
+	if err := client.RegisterTask(task); err != nil {
+		t.Fatalf("cant register task, %v", err)
+	}
+	if err := worker.StartWorker(); err != nil {
+		t.Fatalf("cant start worker, %v", err)
+	}
+	t.Cleanup(func() {
+		worker.StopWorker()
+		client.Close()
+	})
+	return client, worker
+}
+
+// waitFor waits until condition is true
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition was not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWorkerRetry(t *testing.T) {
+	service := &flakyTestService{failures: 2, attempts: make(chan int, 10)}
+	task := &Task{Name: taskName, QueueName: queueName, TProccesser: service, RetryPolicy: NewRetryPolicy(3, NewFixedBackoff(10*time.Millisecond))}
+	client, _ := startTestWorker(t, task)
+	if _, err := client.publisher.PublishTask(taskName, &testSchData{ID: "retry"}); err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	for expected := 1; expected <= 3; expected++ {
+		select {
+		case attempt := <-service.attempts:
+			if attempt != expected {
+				t.Fatalf("invalid attempt %d, must be %d", attempt, expected)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("attempt %d was not proccessed", expected)
+		}
+	}
+	select {
+	case attempt := <-service.attempts:
+		t.Fatalf("unexpected attempt %d after success", attempt)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestWorkerRetryExhausted(t *testing.T) {
+	service := &flakyTestService{failures: 10, attempts: make(chan int, 10)}
+	task := &Task{Name: taskName, QueueName: queueName, TProccesser: service, RetryPolicy: NewRetryPolicy(2, nil)}
+	client, _ := startTestWorker(t, task)
+	if _, err := client.publisher.PublishTask(taskName, &testSchData{ID: "retry"}); err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if len(service.attempts) != 2 {
+		t.Fatalf("task must be proccessed 2 times, got %d", len(service.attempts))
+	}
+}
+
+// ackRecordingBroker memory broker which records acknowledged messages
+type ackRecordingBroker struct {
+	*MemoryBroker
+	lock  sync.Mutex
+	acked []string
+}
+
+func (b *ackRecordingBroker) AckCabbageMessage(queueName string, cbMessage *CabbageMessage) error {
+	b.lock.Lock()
+	b.acked = append(b.acked, cbMessage.ID)
+	b.lock.Unlock()
+	return b.MemoryBroker.AckCabbageMessage(queueName, cbMessage)
+}
+
+func (b *ackRecordingBroker) ackedCount() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return len(b.acked)
+}
+
+type blockingTestService struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingTestService) ProccessTask(ctx context.Context, body []byte, ID string) error {
+	s.started <- struct{}{}
+	<-s.release
+	return nil
+}
+
+func TestWorkerAcksAfterSuccess(t *testing.T) {
+	broker := &ackRecordingBroker{MemoryBroker: NewMemoryBroker()}
+	client := NewCabbageClient(broker)
+	defer client.Close()
+	worker, _ := client.CreateWorker(queueName, 1)
+	service := &blockingTestService{started: make(chan struct{}, 1), release: make(chan struct{})}
+	worker.RegisterTaskProcesser(taskName, service)
+	worker.StartWorker()
+	defer worker.StopWorker()
+	broker.SendCabbageMessage(queueName, cbMessage)
+	select {
+	case <-service.started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("task was not started")
+	}
+	if broker.ackedCount() != 0 {
+		t.Fatal("message must not be acked before task finished")
+	}
+	close(service.release)
+	waitFor(t, func() bool { return broker.ackedCount() == 1 })
+}
+
+type countingTestService struct {
+	count chan struct{}
+}
+
+func (s *countingTestService) ProccessTask(ctx context.Context, body []byte, ID string) error {
+	s.count <- struct{}{}
+	return nil
+}
+
+// proccessMessages send count messages to started worker and returns duration of their proccessing
+func proccessMessages(t *testing.T, worker *CabbageWorker, broker CabbageBroker, count int) time.Duration {
+	service := &countingTestService{count: make(chan struct{}, count)}
+	worker.RegisterTaskProcesser(taskName, service)
+	if err := worker.StartWorker(); err != nil {
+		t.Fatalf("cant start worker, %v", err)
+	}
+	defer worker.StopWorker()
+	start := time.Now()
+	for i := 0; i < count; i++ {
+		broker.SendCabbageMessage(queueName, newCabbageMessage(taskName, body))
+	}
+	for i := 0; i < count; i++ {
+		select {
+		case <-service.count:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("only %d of %d messages proccessed", i, count)
+		}
+	}
+	return time.Since(start)
+}
+
+func TestWorkerBlockingReceive(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	worker := newCabbageWorker(broker, 1, queueName)
+	if elapsed := proccessMessages(t, worker, broker, 100); elapsed > time.Second {
+		t.Errorf("100 messages must be proccessed without polling delay, took %s", elapsed)
+	}
+}
+
+// stopRaceBroker memory broker which returns received message only after receive context is done
+type stopRaceBroker struct {
+	*MemoryBroker
+	received chan struct{}
+}
+
+func (b *stopRaceBroker) GetCabbageMessageWithContext(ctx context.Context, queueName string) (*CabbageMessage, error) {
+	cbMessage, err := b.MemoryBroker.GetCabbageMessageWithContext(ctx, queueName)
+	if err != nil {
+		return nil, err
+	}
+	close(b.received)
+	<-ctx.Done()
+	return cbMessage, nil
+}
+
+func TestWorkerStopRequeuesReceivedMessage(t *testing.T) {
+	broker := &stopRaceBroker{MemoryBroker: NewMemoryBroker(), received: make(chan struct{})}
+	client := NewCabbageClient(broker)
+	defer client.Close()
+	worker, _ := client.CreateWorker(queueName, 1)
+	service := &countingTestService{count: make(chan struct{}, 1)}
+	worker.RegisterTaskProcesser(taskName, service)
+	worker.StartWorker()
+	broker.SendCabbageMessage(queueName, newCabbageMessage(taskName, body))
+	select {
+	case <-broker.received:
+	case <-time.After(2 * time.Second):
+		t.Fatal("message was not received")
+	}
+	worker.StopWorker()
+	if len(service.count) != 0 {
+		t.Fatal("message must not be proccessed after worker stop")
+	}
+	if _, err := broker.GetCabbageMessage(queueName); err != nil {
+		t.Errorf("message received during stop must be returned to queue, got %v", err)
+	}
+}
+
+func TestWorkerRateLimit(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+	worker := newCabbageWorker(broker, 1, queueName)
+	worker.SetRateLimitPeriod(50 * time.Millisecond)
+	if elapsed := proccessMessages(t, worker, broker, 5); elapsed < 200*time.Millisecond {
+		t.Errorf("5 messages with 50ms rate limit must take at least 200ms, took %s", elapsed)
+	}
+}
+
+type sleepingTestService struct {
+	sleep     time.Duration
+	ignoreCtx bool
+	errs      chan error
+}
+
+func (s *sleepingTestService) ProccessTask(ctx context.Context, body []byte, ID string) error {
+	if s.ignoreCtx {
+		time.Sleep(s.sleep)
+		return nil
+	}
+	select {
+	case <-time.After(s.sleep):
+		s.errs <- nil
+		return nil
+	case <-ctx.Done():
+		s.errs <- ctx.Err()
+		return ctx.Err()
+	}
+}
+
+// waitDeadLetter waits for single dead letter in memory broker queue
+func waitDeadLetter(t *testing.T, broker *MemoryBroker) *CabbageMessage {
+	var deadLetters []*CabbageMessage
+	waitFor(t, func() bool {
+		deadLetters, _ = broker.GetDeadLetters(queueName, 0)
+		return len(deadLetters) == 1
+	})
+	return deadLetters[0]
+}
+
+func TestWorkerSoftTimeout(t *testing.T) {
+	service := &sleepingTestService{sleep: time.Second, errs: make(chan error, 1)}
+	task := &Task{Name: taskName, QueueName: queueName, TProccesser: service, Timeout: 50 * time.Millisecond}
+	client, _ := startTestWorker(t, task)
+	if _, err := client.publisher.PublishTask(taskName, &testSchData{ID: "timeout"}); err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	select {
+	case err := <-service.errs:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("task context must be cancelled by timeout, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("task was not proccessed")
+	}
+	deadLetter := waitDeadLetter(t, client.broker.(*MemoryBroker))
+	if deadLetter.DeadLetter.Reason != DeadLetterReasonTimeout {
+		t.Errorf("invalid dead letter reason %s", deadLetter.DeadLetter.Reason)
+	}
+}
+
+func TestWorkerMessageTimeoutOverride(t *testing.T) {
+	service := &sleepingTestService{sleep: 100 * time.Millisecond, errs: make(chan error, 1)}
+	task := &Task{Name: taskName, QueueName: queueName, TProccesser: service, Timeout: 50 * time.Millisecond}
+	client, _ := startTestWorker(t, task)
+	if _, err := client.publisher.PublishTask(taskName, &testSchData{ID: "timeout"}, Timeout(time.Second)); err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	select {
+	case err := <-service.errs:
+		if err != nil {
+			t.Fatalf("message timeout must override task timeout, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("task was not proccessed")
+	}
+}
+
+func TestWorkerHardTimeout(t *testing.T) {
+	service := &sleepingTestService{sleep: 500 * time.Millisecond, ignoreCtx: true}
+	task := &Task{Name: taskName, QueueName: queueName, TProccesser: service, HardTimeout: 50 * time.Millisecond}
+	client, worker := startTestWorker(t, task)
+	if _, err := client.publisher.PublishTask(taskName, &testSchData{ID: "timeout"}); err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	deadLetter := waitDeadLetter(t, client.broker.(*MemoryBroker))
+	if deadLetter.DeadLetter.Reason != DeadLetterReasonTimeout {
+		t.Errorf("invalid dead letter reason %s", deadLetter.DeadLetter.Reason)
+	}
+	if worker.AbandonedTasks() != 1 {
+		t.Errorf("worker must report 1 abandoned task, got %d", worker.AbandonedTasks())
+	}
+}
+
+func TestWorkerHardTimeoutCancelsContext(t *testing.T) {
+	cancelled := make(chan struct{})
+	slow := TaskProccesserFunc(func(ctx context.Context, body []byte, ID string) error {
+		// task checks context only after hard timeout
+		time.Sleep(100 * time.Millisecond)
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+	client, _ := startTestWorker(t, &Task{Name: taskName, QueueName: queueName, TProccesser: slow, HardTimeout: 50 * time.Millisecond})
+	if _, err := client.publisher.PublishTask(taskName, &testSchData{ID: "timeout"}); err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("context of abandoned task must be cancelled")
+	}
+}
+
+type panicTestService struct {
+	attempts chan int
+}
+
+func (s *panicTestService) ProccessTask(ctx context.Context, body []byte, ID string) error {
+	attempt := TaskAttemptFromContext(ctx)
+	s.attempts <- attempt
+	if attempt == 1 {
+		panic("test panic")
+	}
+	return nil
+}
+
+func TestWorkerPanicRetry(t *testing.T) {
+	service := &panicTestService{attempts: make(chan int, 10)}
+	task := &Task{Name: taskName, QueueName: queueName, TProccesser: service, RetryPolicy: NewRetryPolicy(2, nil)}
+	client, _ := startTestWorker(t, task)
+	if _, err := client.publisher.PublishTask(taskName, &testSchData{ID: "panic"}); err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	waitFor(t, func() bool { return len(service.attempts) == 2 })
+	time.Sleep(100 * time.Millisecond)
+	if deadLetters, _ := client.DeadLetters(queueName, 0); len(deadLetters) != 0 {
+		t.Fatalf("task must succeed after panic retry, got %d dead letters", len(deadLetters))
+	}
+}
+
+func TestWorkerPanicDeadLetter(t *testing.T) {
+	service := &panicTestService{attempts: make(chan int, 10)}
+	task := &Task{Name: taskName, QueueName: queueName, TProccesser: service}
+	client, _ := startTestWorker(t, task)
+	if _, err := client.publisher.PublishTask(taskName, &testSchData{ID: "panic"}); err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	deadLetter := waitDeadLetter(t, client.broker.(*MemoryBroker))
+	if deadLetter.DeadLetter.Reason != DeadLetterReasonPanic {
+		t.Errorf("invalid dead letter reason %s", deadLetter.DeadLetter.Reason)
+	}
+	if !strings.Contains(deadLetter.DeadLetter.Error, "test panic") || !strings.Contains(deadLetter.DeadLetter.Error, "goroutine") {
+		t.Errorf("dead letter error must contain panic value and stack, got %s", deadLetter.DeadLetter.Error)
+	}
+	// worker goroutine must survive panic
+	if _, err := client.publisher.PublishTask(taskName, &testSchData{ID: "after panic"}); err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	waitFor(t, func() bool { return len(service.attempts) == 2 })
+}
+
+type headersTestService struct {
+	headers chan map[string]string
+}
+
+func (s *headersTestService) ProccessTask(ctx context.Context, body []byte, ID string) error {
+	s.headers <- HeadersFromContext(ctx)
+	return nil
+}
+
+func TestWorkerHeadersFromContext(t *testing.T) {
+	service := &headersTestService{headers: make(chan map[string]string, 1)}
+	client, _ := startTestWorker(t, &Task{Name: taskName, QueueName: queueName, TProccesser: service})
+	_, err := client.publisher.PublishTask(taskName, &testSchData{ID: "headers"},
+		Headers(map[string]string{"tenant": "acme"}), Header("correlation-id", "42"))
+	if err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	select {
+	case headers := <-service.headers:
+		if len(headers) != 2 || headers["tenant"] != "acme" || headers["correlation-id"] != "42" {
+			t.Errorf("invalid headers %v", headers)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("task was not proccessed")
+	}
+}
+
+type taskInfoTestService struct {
+	infos chan *TaskInfo
+}
+
+func (s *taskInfoTestService) ProccessTask(ctx context.Context, body []byte, ID string) error {
+	info := TaskInfoFromContext(ctx)
+	s.infos <- info
+	if !info.IsLastAttempt() {
+		return errors.New("retry")
+	}
+	return nil
+}
+
+func TestWorkerTaskInfoFromContext(t *testing.T) {
+	service := &taskInfoTestService{infos: make(chan *TaskInfo, 2)}
+	task := &Task{Name: taskName, QueueName: queueName, TProccesser: service, RetryPolicy: NewRetryPolicy(2, nil)}
+	client, _ := startTestWorker(t, task)
+	asyncResult, err := client.publisher.PublishTask(taskName, &testSchData{ID: "info"}, Header("tenant", "acme"), Countdown(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("cant publish task, %v", err)
+	}
+	for attempt := 1; attempt <= 2; attempt++ {
+		select {
+		case info := <-service.infos:
+			if info.ID != asyncResult.ID || info.TaskName != taskName || info.Queue != queueName || info.Headers["tenant"] != "acme" {
+				t.Errorf("invalid task info %+v", info)
+			}
+			if info.Attempt != attempt || info.MaxAttempts != 2 {
+				t.Errorf("invalid attempt %d of %d, expected %d", info.Attempt, info.MaxAttempts, attempt)
+			}
+			if attempt == 1 && (info.ETA == nil || info.QueueLatency() < 0 || info.StartedAt.Sub(info.PublishedAt) < 50*time.Millisecond) {
+				t.Errorf("invalid delayed task timings %+v", info)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("attempt %d was not proccessed", attempt)
+		}
+	}
+	if TaskInfoFromContext(context.Background()) != nil {
+		t.Error("task info must be nil outside of worker")
+	}
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -21,14 +20,9 @@ type TestData struct {
 type TestService struct {
 }
 
-func (t TestService) ProccessTask(ctx context.Context, body []byte, ID string) error {
-	var td TestData
-	err := json.Unmarshal(body, &td)
-	if err != nil {
-		return err
-	}
+func (t TestService) ProccessTask(ctx context.Context, td TestData) error {
 	fmt.Println("Start task")
-	fmt.Println(t)
+	fmt.Println(td)
 	return nil
 }
 
@@ -44,8 +38,12 @@ func main() {
 	}
 	client := cabbage.NewCabbageClient(broker)
 	worker, _ := client.CreateWorker("cabbageQueue", 4)
-	task := cabbage.Task{QueueName: "cabbageQueue", Name: "TestTask", TProccesser: NewTestService()}
-	client.RegisterTask(&task)
+	task, err := cabbage.NewTypedTask("TestTask", "cabbageQueue", NewTestService().ProccessTask)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	client.RegisterTask(task)
 	defer client.Close()
 	fmt.Println("Successfully Connected to our RabbitMQ Instance")
 	fmt.Println(" [*] - Waiting for messages")